@@ -3,7 +3,10 @@ package main
 import (
 	"log"
 	"os"
+	"time"
 
+	"irontrack-backend/internal/account"
+	"irontrack-backend/internal/auth"
 	"irontrack-backend/internal/database"
 	"irontrack-backend/internal/router"
 
@@ -21,6 +24,13 @@ func main() {
 
 	database.InitDatabase()
 
+	// Carry out account deletions whose grace period has ended
+	account.StartPurger(time.Hour)
+
+	if err := auth.LoadKeys(); err != nil {
+		log.Fatal("Failed to load JWT keys:", err)
+	}
+
 	r := router.SetupRouter(GitCommit, BuildTime)
 
 	// Get port from environment variable, default to 8080
@@ -0,0 +1,181 @@
+// Package account implements the user's own data rights: exporting everything
+// we hold about them and closing the account. A deletion request only
+// schedules the purge, so a change of heart within DeletionGrace can be
+// undone; after that every row belonging to the user is hard-deleted.
+package account
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/loginguard"
+	"irontrack-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// DeletionGrace is how long a deletion request can be cancelled before the
+// account is purged. Set ACCOUNT_DELETION_GRACE (e.g. "72h") to change it.
+var DeletionGrace = durationFromEnv("ACCOUNT_DELETION_GRACE", 14*24*time.Hour)
+
+var ErrDeletionNotScheduled = errors.New("account deletion is not scheduled")
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return fallback
+}
+
+// ScheduleDeletion marks the account for purging after DeletionGrace and
+// returns when that will happen. Asking again keeps the original date.
+func ScheduleDeletion(userID string) (time.Time, error) {
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		return time.Time{}, err
+	}
+	if user.DeletionScheduledAt != nil {
+		return *user.DeletionScheduledAt, nil
+	}
+
+	at := time.Now().Add(DeletionGrace)
+	err := database.DB.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"deletion_scheduled_at": at,
+		"updated_at":            time.Now(),
+	}).Error
+	return at, err
+}
+
+// CancelDeletion clears a pending deletion request.
+func CancelDeletion(userID string) error {
+	result := database.DB.Model(&models.User{}).
+		Where("id = ? AND deletion_scheduled_at IS NOT NULL", userID).
+		Updates(map[string]interface{}{
+			"deletion_scheduled_at": nil,
+			"updated_at":            time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeletionNotScheduled
+	}
+	return nil
+}
+
+// Purge hard-deletes the user and every row that belongs to them. The
+// impersonation audit trail is kept: it is the staff's record of what they
+// did, not the user's data.
+func Purge(userID string) error {
+	var user models.User
+	if err := database.DB.Unscoped().Where("id = ?", userID).First(&user).Error; err != nil {
+		return err
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		logIDs := tx.Model(&models.WorkoutLog{}).Select("id").Where("user_id = ?", userID)
+		logExerciseIDs := tx.Model(&models.LogExercise{}).Select("id").Where("log_id IN (?)", logIDs)
+		planIDs := tx.Model(&models.WorkoutPlan{}).Select("id").Where("user_id = ?", userID)
+		programIDs := tx.Model(&models.Program{}).Select("id").Where("user_id = ?", userID)
+		programWeekIDs := tx.Model(&models.ProgramWeek{}).Select("id").Where("program_id IN (?)", programIDs)
+
+		// Children first, so this works whether or not the database enforces cascades
+		if err := tx.Where("log_exercise_id IN (?)", logExerciseIDs).Delete(&models.LogSet{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("log_id IN (?)", logIDs).Delete(&models.LogExercise{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("plan_id IN (?)", planIDs).Delete(&models.PlanExercise{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("week_id IN (?)", programWeekIDs).Delete(&models.ProgramDay{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("program_id IN (?)", programIDs).Delete(&models.ProgramWeek{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM user_roles WHERE user_id = ?", userID).Error; err != nil {
+			return err
+		}
+
+		owned := []interface{}{
+			&models.WorkoutLog{},
+			&models.WorkoutPlan{},
+			&models.ProgramProgress{},
+			&models.Program{},
+			&models.UserProfile{},
+			&models.ExerciseDefinition{},
+			&models.AIRequestLog{},
+			&models.Session{},
+			&models.UserToken{},
+			&models.RecoveryCode{},
+			&models.UserIdentity{},
+			&models.PersonalAccessToken{},
+			&models.WebAuthnCredential{},
+			&models.WebAuthnCeremony{},
+		}
+		for _, model := range owned {
+			if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Where("id = ?", userID).Delete(&models.User{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := loginguard.Default().Unlock(loginguard.AccountKey(user.Email)); err != nil {
+		log.Printf("Failed to clear login attempts for purged user %s: %v", userID, err)
+	}
+	return nil
+}
+
+// PurgeDue purges every account whose grace period ended before now and
+// returns how many were purged. A failure is logged and skipped so one bad
+// account doesn't hold up the rest; all failures are returned together.
+func PurgeDue(now time.Time) (int, error) {
+	var ids []string
+	err := database.DB.Unscoped().Model(&models.User{}).
+		Where("deletion_scheduled_at <= ?", now).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	var errs []error
+	for _, id := range ids {
+		if err := Purge(id); err != nil {
+			log.Printf("Failed to purge account %s: %v", id, err)
+			errs = append(errs, fmt.Errorf("purge %s: %w", id, err))
+			continue
+		}
+		purged++
+	}
+	return purged, errors.Join(errs...)
+}
+
+// StartPurger runs PurgeDue every interval in the background.
+func StartPurger(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			n, err := PurgeDue(now)
+			if err != nil {
+				log.Printf("Account purge failed: %v", err)
+			}
+			if n > 0 {
+				log.Printf("Purged %d deleted accounts", n)
+			}
+		}
+	}()
+}
@@ -0,0 +1,83 @@
+package account
+
+import (
+	"errors"
+	"time"
+
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Export is everything stored about a user, as handed to them on request.
+// Secrets (password and token hashes, TOTP secret, passkey public keys) are
+// left out by the models' JSON tags.
+type Export struct {
+	ExportedAt   time.Time                    `json:"exportedAt"`
+	Account      models.User                  `json:"account"`
+	Profile      *models.UserProfile          `json:"profile"`
+	Plans        []models.WorkoutPlan         `json:"plans"`
+	Programs     []models.Program             `json:"programs"`
+	Progress     *models.ProgramProgress      `json:"programProgress"`
+	Logs         []models.WorkoutLog          `json:"logs"`
+	Exercises    []models.ExerciseDefinition  `json:"exercises"`
+	AIRequests   []models.AIRequestLog        `json:"aiRequests"`
+	Sessions     []models.Session             `json:"sessions"`
+	Identities   []models.UserIdentity        `json:"identities"`
+	Passkeys     []models.WebAuthnCredential  `json:"passkeys"`
+	AccessTokens []models.PersonalAccessToken `json:"accessTokens"`
+}
+
+// BuildExport collects the user's data for download.
+func BuildExport(userID string) (*Export, error) {
+	export := Export{ExportedAt: time.Now().UTC()}
+	db := database.DB
+
+	if err := db.Preload("Roles").Where("id = ?", userID).First(&export.Account).Error; err != nil {
+		return nil, err
+	}
+
+	var profile models.UserProfile
+	err := db.Where("user_id = ?", userID).First(&profile).Error
+	switch {
+	case err == nil:
+		export.Profile = &profile
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	var progress models.ProgramProgress
+	err = db.Where("user_id = ?", userID).First(&progress).Error
+	switch {
+	case err == nil:
+		export.Progress = &progress
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	queries := []struct {
+		dest  interface{}
+		query *gorm.DB
+	}{
+		{&export.Plans, db.Preload("Exercises", byPosition).Order("created_at asc")},
+		{&export.Programs, db.Preload("Weeks", func(db *gorm.DB) *gorm.DB { return db.Order("number asc") }).Preload("Weeks.Days", byPosition).Order("created_at asc")},
+		{&export.Logs, db.Preload("Exercises", byPosition).Preload("Exercises.Sets", byPosition).Order("date asc")},
+		{&export.Exercises, db.Order("name asc")},
+		{&export.AIRequests, db.Order("created_at asc")},
+		{&export.Sessions, db.Order("created_at asc")},
+		{&export.Identities, db.Order("created_at asc")},
+		{&export.Passkeys, db.Order("created_at asc")},
+		{&export.AccessTokens, db.Order("created_at asc")},
+	}
+	for _, q := range queries {
+		if err := q.query.Where("user_id = ?", userID).Find(q.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &export, nil
+}
+
+func byPosition(db *gorm.DB) *gorm.DB {
+	return db.Order("position asc, id asc")
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// PersonalTokenPrefix marks personal access tokens so AuthMiddleware can tell
+// them apart from JWTs, and so leaked tokens are easy to spot in code.
+const PersonalTokenPrefix = "itk_"
+
+var ErrInvalidPersonalAccessToken = errors.New("invalid personal access token")
+
+// CreatePersonalAccessToken issues a token for the user and returns it together
+// with the plaintext, which is shown to the user once and never stored.
+func CreatePersonalAccessToken(userID, name string, scopes []string, ttl time.Duration) (*models.PersonalAccessToken, string, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	plaintext := PersonalTokenPrefix + secret
+
+	now := time.Now()
+	token := models.PersonalAccessToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    plaintext[:len(PersonalTokenPrefix)+6],
+		TokenHash: HashToken(plaintext),
+		Scopes:    uniqueStrings(scopes),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if err := database.DB.Create(&token).Error; err != nil {
+		return nil, "", err
+	}
+	return &token, plaintext, nil
+}
+
+// LookupPersonalAccessToken returns the active token matching plaintext.
+func LookupPersonalAccessToken(plaintext string) (*models.PersonalAccessToken, error) {
+	var token models.PersonalAccessToken
+	if err := database.DB.Where("token_hash = ?", HashToken(plaintext)).First(&token).Error; err != nil {
+		return nil, ErrInvalidPersonalAccessToken
+	}
+	if token.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+		return nil, ErrInvalidPersonalAccessToken
+	}
+	return &token, nil
+}
+
+// TouchPersonalAccessToken records use of a token, at most once per lastSeenInterval.
+func TouchPersonalAccessToken(token *models.PersonalAccessToken) {
+	now := time.Now()
+	if token.LastUsedAt != nil && now.Sub(*token.LastUsedAt) < lastSeenInterval {
+		return
+	}
+	_ = database.DB.Model(&models.PersonalAccessToken{}).Where("id = ?", token.ID).Update("last_used_at", now).Error
+}
+
+// ListPersonalAccessTokens returns the user's tokens that can still be used, newest first.
+func ListPersonalAccessTokens(userID string) ([]models.PersonalAccessToken, error) {
+	var tokens []models.PersonalAccessToken
+	err := database.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("created_at desc").
+		Find(&tokens).Error
+	return tokens, err
+}
+
+// RevokePersonalAccessToken revokes one of the user's tokens. It reports
+// whether a matching active token was found.
+func RevokePersonalAccessToken(userID, tokenID string) (bool, error) {
+	result := database.DB.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeAllPersonalAccessTokens revokes every token of the user, e.g. after a
+// password reset.
+func RevokeAllPersonalAccessTokens(userID string) error {
+	return database.DB.Model(&models.PersonalAccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// authenticatePersonalAccessToken is AuthMiddleware's path for personal access tokens.
+func authenticatePersonalAccessToken(c *gin.Context, plaintext string) bool {
+	token, err := LookupPersonalAccessToken(plaintext)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return false
+	}
+
+	var user models.User
+	if err := database.DB.Select("id", "email").Where("id = ?", token.UserID).First(&user).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return false
+	}
+	TouchPersonalAccessToken(token)
+
+	c.Set("userID", user.ID)
+	c.Set("email", user.Email)
+	c.Set("personalTokenID", token.ID)
+	c.Set("tokenScopes", token.Scopes)
+	return true
+}
+
+// RequireScope limits a route to personal access tokens carrying the scope.
+// Requests made with a login session are not affected.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("personalTokenID") == "" {
+			c.Next()
+			return
+		}
+		for _, s := range c.GetStringSlice("tokenScopes") {
+			if s == scope {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Token is missing scope: " + scope,
+			"code":  "insufficient_scope",
+		})
+		c.Abort()
+	}
+}
+
+// RequireSession rejects personal access tokens and impersonation tokens. Use
+// it on routes that manage the account itself (sessions, 2FA, tokens) and on
+// admin routes, so a leaked script token can't be used to take over an account
+// and staff can't act with the target user's privileges.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("personalTokenID") != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint can't be used with a personal access token"})
+			c.Abort()
+			return
+		}
+		if c.GetString("impersonatorID") != "" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "This endpoint can't be used while impersonating a user",
+				"code":  "impersonation_not_allowed",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func isPersonalAccessToken(s string) bool {
+	return strings.HasPrefix(s, PersonalTokenPrefix)
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ImpersonationTTL is how long an impersonation token stays valid. It can't be
+// refreshed; staff start a new impersonation when it runs out.
+var ImpersonationTTL = durationFromEnv("IMPERSONATION_TTL", 30*time.Minute)
+
+var ErrImpersonationEnded = errors.New("impersonation has ended")
+
+// StartImpersonation opens an audited, read-only session for the target user
+// on behalf of adminID and returns it with an access token for that session.
+func StartImpersonation(adminID string, target *models.User, reason, ipAddress string) (*models.Impersonation, string, error) {
+	// The session's refresh token is never handed out, so it can't outlive ImpersonationTTL
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:               uuid.New().String(),
+		UserID:           target.ID,
+		RefreshTokenHash: HashToken(secret),
+		DeviceName:       "Support impersonation",
+		IPAddress:        ipAddress,
+		CreatedAt:        now,
+		LastSeenAt:       now,
+		ExpiresAt:        now.Add(ImpersonationTTL),
+		ImpersonatorID:   adminID,
+	}
+	impersonation := models.Impersonation{
+		ID:        uuid.New().String(),
+		AdminID:   adminID,
+		UserID:    target.ID,
+		SessionID: session.ID,
+		Reason:    reason,
+		IPAddress: ipAddress,
+		CreatedAt: now,
+		ExpiresAt: session.ExpiresAt,
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Create(&session).Error; err != nil {
+		tx.Rollback()
+		return nil, "", err
+	}
+	if err := tx.Create(&impersonation).Error; err != nil {
+		tx.Rollback()
+		return nil, "", err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, "", err
+	}
+
+	token, err := GenerateImpersonationToken(target.ID, target.Email, session.ID, adminID, session.ExpiresAt)
+	if err != nil {
+		return nil, "", err
+	}
+	return &impersonation, token, nil
+}
+
+// EndImpersonation revokes the impersonation's session. It reports whether the
+// impersonation was still running.
+func EndImpersonation(impersonation *models.Impersonation) (bool, error) {
+	if impersonation.EndedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	if err := RevokeSession(impersonation.SessionID); err != nil {
+		return false, err
+	}
+	if err := database.DB.Model(impersonation).Update("ended_at", now).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// activeImpersonation loads the impersonation behind a session and checks the
+// token's actor is the staff user who started it.
+func activeImpersonation(session *models.Session, actorID string) (*models.Impersonation, error) {
+	if session.ImpersonatorID == "" || session.ImpersonatorID != actorID {
+		return nil, ErrImpersonationEnded
+	}
+	var impersonation models.Impersonation
+	if err := database.DB.Where("session_id = ?", session.ID).First(&impersonation).Error; err != nil {
+		return nil, ErrImpersonationEnded
+	}
+	if impersonation.EndedAt != nil {
+		return nil, ErrImpersonationEnded
+	}
+	return &impersonation, nil
+}
+
+// impersonatedRequest is AuthMiddleware's path for impersonation tokens. Staff
+// can only look: anything but a read is refused. Every request is recorded,
+// refused or not, and one that can't be recorded isn't served.
+func impersonatedRequest(c *gin.Context, impersonation *models.Impersonation) {
+	record := models.ImpersonationRequest{
+		ID:              uuid.New().String(),
+		ImpersonationID: impersonation.ID,
+		Method:          c.Request.Method,
+		Path:            c.Request.URL.RequestURI(),
+		CreatedAt:       time.Now(),
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		log.Printf("Failed to record impersonated request %s %s: %v", record.Method, record.Path, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record impersonated request"})
+		c.Abort()
+		return
+	}
+
+	c.Set("impersonatorID", impersonation.AdminID)
+	c.Set("impersonationID", impersonation.ID)
+
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+	default:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Changes can't be made while impersonating a user",
+			"code":  "impersonation_read_only",
+		})
+		c.Abort()
+	}
+
+	if err := database.DB.Model(&record).Update("status", c.Writer.Status()).Error; err != nil {
+		log.Printf("Failed to record status of impersonated request %s: %v", record.ID, err)
+	}
+}
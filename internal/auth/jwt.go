@@ -2,14 +2,36 @@ package auth
 
 import (
 	"errors"
-	"time"
 	"os"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 var SecretKey = []byte(getSecret())
 
+// AccessTokenTTL is how long a bearer token stays valid. Keep it short: clients
+// are expected to use their refresh token to get a new one.
+var AccessTokenTTL = durationFromEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+
+// RefreshTokenTTL is how long a session may stay idle before its refresh token
+// stops working. Every refresh pushes the expiry out again.
+var RefreshTokenTTL = durationFromEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+
+// Issuer and Audience are stamped into every token as iss/aud and checked on
+// validation, so tokens from another environment or service are rejected.
+var (
+	Issuer   = envOr("JWT_ISSUER", "irontrack-backend")
+	Audience = envOr("JWT_AUDIENCE", "irontrack-api")
+)
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
 func getSecret() string {
 	s := os.Getenv("JWT_SECRET")
 	if s == "" {
@@ -18,30 +40,61 @@ func getSecret() string {
 	return s
 }
 
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return fallback
+}
+
 type Claims struct {
-	UserID string `json:"userId"`
-	Email  string `json:"email"`
+	UserID    string `json:"userId"`
+	Email     string `json:"email"`
+	SessionID string `json:"sid,omitempty"`
+	// Actor is set when a staff user is acting as UserID (RFC 8693 "act").
+	Actor *ActorClaim `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID, email string) (string, error) {
-	claims := &Claims{
-		UserID: userID,
-		Email:  email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour * 30)), // 30 days
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
+// ActorClaim identifies who is really making requests with an impersonation token.
+type ActorClaim struct {
+	Subject string `json:"sub"`
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(SecretKey)
+func GenerateToken(userID, email, sessionID string) (string, error) {
+	return signClaims(&Claims{UserID: userID, Email: email, SessionID: sessionID}, time.Now().Add(AccessTokenTTL))
+}
+
+// GenerateImpersonationToken issues a token that lets actorID act as the user
+// until expiresAt. It carries an "act" claim so it can't pass as a normal login.
+func GenerateImpersonationToken(userID, email, sessionID, actorID string, expiresAt time.Time) (string, error) {
+	return signClaims(&Claims{
+		UserID:    userID,
+		Email:     email,
+		SessionID: sessionID,
+		Actor:     &ActorClaim{Subject: actorID},
+	}, expiresAt)
+}
+
+func signClaims(claims *Claims, expiresAt time.Time) (string, error) {
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    Issuer,
+		Subject:   claims.UserID,
+		Audience:  jwt.ClaimStrings{Audience},
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+	}
+	return keys().sign(claims)
 }
 
 func ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return SecretKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keys().keyFunc,
+		jwt.WithIssuer(Issuer),
+		jwt.WithAudience(Audience),
+		jwt.WithExpirationRequired(),
+	)
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// hmacKeyID is the kid used for tokens signed with JWT_SECRET when no
+// asymmetric keys are configured.
+const hmacKeyID = "hs256"
+
+// jwtKey is one key in the key set. Private is nil for keys that are only
+// kept around to verify tokens issued before a rotation.
+type jwtKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.PrivateKey
+	Public  crypto.PublicKey
+}
+
+// KeySet holds the key used to sign new tokens and every key that is still
+// accepted when verifying them.
+type KeySet struct {
+	active *jwtKey
+	keys   map[string]*jwtKey
+}
+
+var (
+	keysMu     sync.RWMutex
+	currentSet *KeySet
+)
+
+// LoadKeys (re)loads the signing keys from the environment:
+//   - JWT_KEYS_DIR: directory of PEM files named <kid>.pem. Private keys (RSA,
+//     Ed25519 or ECDSA P-256) can sign and verify; public keys only verify, which
+//     is how a retired key stays valid until the tokens it signed have expired.
+//   - JWT_ACTIVE_KID: the key that signs new tokens. Optional when the
+//     directory holds a single private key.
+//
+// Without JWT_KEYS_DIR tokens are signed with HS256 using JWT_SECRET.
+func LoadKeys() error {
+	set, err := loadKeySet(os.Getenv("JWT_KEYS_DIR"), os.Getenv("JWT_ACTIVE_KID"))
+	if err != nil {
+		return err
+	}
+
+	keysMu.Lock()
+	currentSet = set
+	keysMu.Unlock()
+	return nil
+}
+
+func keys() *KeySet {
+	keysMu.RLock()
+	set := currentSet
+	keysMu.RUnlock()
+	if set != nil {
+		return set
+	}
+
+	if err := LoadKeys(); err != nil {
+		log.Fatal("Failed to load JWT keys:", err)
+	}
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	return currentSet
+}
+
+func loadKeySet(dir, activeKID string) (*KeySet, error) {
+	if dir == "" {
+		key := &jwtKey{ID: hmacKeyID, Method: jwt.SigningMethodHS256, Private: SecretKey, Public: SecretKey}
+		return &KeySet{active: key, keys: map[string]*jwtKey{key.ID: key}}, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	set := &KeySet{keys: map[string]*jwtKey{}}
+	var signers []*jwtKey
+	for _, path := range paths {
+		key, err := loadPEMKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		set.keys[key.ID] = key
+		if key.Private != nil {
+			signers = append(signers, key)
+		}
+	}
+
+	switch {
+	case activeKID != "":
+		key, ok := set.keys[activeKID]
+		if !ok || key.Private == nil {
+			return nil, fmt.Errorf("no private key found for JWT_ACTIVE_KID %q", activeKID)
+		}
+		set.active = key
+	case len(signers) == 1:
+		set.active = signers[0]
+	default:
+		return nil, errors.New("set JWT_ACTIVE_KID to choose the signing key")
+	}
+	return set, nil
+}
+
+func loadPEMKey(path string) (*jwtKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	key := &jwtKey{ID: strings.TrimSuffix(filepath.Base(path), ".pem")}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key.Private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key.Private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key.Private, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key.Public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if signer, ok := key.Private.(crypto.Signer); ok {
+		key.Public = signer.Public()
+	}
+
+	switch pub := key.Public.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 ECDSA keys are supported")
+		}
+		key.Method = jwt.SigningMethodES256
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key.Public)
+	}
+	return key, nil
+}
+
+// sign signs claims with the active key and sets the kid header.
+func (s *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.active.Method, claims)
+	token.Header["kid"] = s.active.ID
+	return token.SignedString(s.active.Private)
+}
+
+// keyFunc picks the verification key by kid and makes sure the token's
+// algorithm matches that key, so a public key can't be used as an HMAC secret.
+func (s *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" && s.active.ID == hmacKeyID {
+		kid = hmacKeyID // tokens issued before key IDs were introduced
+	}
+
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.Public, nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWKS returns every asymmetric verification key so other services can
+// verify our tokens. HMAC secrets are never published.
+func PublicJWKS() JWKSet {
+	set := keys()
+	out := JWKSet{Keys: []JWK{}}
+	for _, key := range set.keys {
+		if jwk, ok := toJWK(key); ok {
+			out.Keys = append(out.Keys, jwk)
+		}
+	}
+	sort.Slice(out.Keys, func(i, j int) bool { return out.Keys[i].Kid < out.Keys[j].Kid })
+	return out
+}
+
+func toJWK(key *jwtKey) (JWK, bool) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+
+	switch pub := key.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = b64(pub.N.Bytes())
+		jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64(pub)
+	case *ecdsa.PublicKey:
+		ecdh, err := pub.ECDH()
+		if err != nil {
+			return JWK{}, false
+		}
+		// Uncompressed point: 0x04 || X || Y
+		point := ecdh.Bytes()
+		size := (len(point) - 1) / 2
+		jwk.Kty = "EC"
+		jwk.Crv = "P-256"
+		jwk.X = b64(point[1 : 1+size])
+		jwk.Y = b64(point[1+size:])
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
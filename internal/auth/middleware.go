@@ -1,11 +1,11 @@
 package auth
 
 import (
-	"irontrack-backend/internal/database"
-	"irontrack-backend/internal/models"
 	"net/http"
 	"strings"
 
+	"irontrack-backend/internal/models"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -26,6 +26,13 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenString := parts[1]
+		if isPersonalAccessToken(tokenString) {
+			if authenticatePersonalAccessToken(c, tokenString) {
+				c.Next()
+			}
+			return
+		}
+
 		claims, err := ValidateToken(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
@@ -33,35 +40,36 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		c.Set("userID", claims.UserID)
-		c.Set("email", claims.Email)
-		c.Next()
-	}
-}
-
-// AdminMiddleware checks if the user is an admin
-func AdminMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userID := c.GetString("userID")
-		if userID == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		// Access tokens are only as good as the session behind them, so a logout
+		// or a revoke from another device takes effect immediately.
+		session, err := CheckSession(claims.SessionID, claims.UserID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired or revoked"})
 			c.Abort()
 			return
 		}
-
-		var user models.User
-		if err := database.DB.Select("is_admin").Where("id = ?", userID).First(&user).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
-			c.Abort()
-			return
+		var impersonation *models.Impersonation
+		if claims.Actor != nil || session.ImpersonatorID != "" {
+			actorID := ""
+			if claims.Actor != nil {
+				actorID = claims.Actor.Subject
+			}
+			if impersonation, err = activeImpersonation(session, actorID); err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired or revoked"})
+				c.Abort()
+				return
+			}
 		}
+		TouchSession(session, c.ClientIP())
 
-		if !user.IsAdmin {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
-			c.Abort()
+		c.Set("userID", claims.UserID)
+		c.Set("email", claims.Email)
+		c.Set("sessionID", claims.SessionID)
+		c.Set("twoFactorVerified", session.TwoFactorVerified)
+		if impersonation != nil {
+			impersonatedRequest(c, impersonation)
 			return
 		}
-
 		c.Next()
 	}
 }
@@ -0,0 +1,384 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDCProvider is an OpenID Connect identity provider configured from the
+// environment. For a provider named "google":
+//
+//	OIDC_PROVIDERS=google,apple
+//	OIDC_GOOGLE_ISSUER=https://accounts.google.com
+//	OIDC_GOOGLE_CLIENT_ID=...
+//	OIDC_GOOGLE_CLIENT_SECRET=...   (optional for public clients)
+//	OIDC_GOOGLE_REDIRECT_URL=https://app.example.com/oauth/callback
+//	OIDC_GOOGLE_SCOPES=openid email profile   (optional)
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// OIDCIdentity is what we take from a verified ID token.
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+var ErrUnknownOIDCProvider = errors.New("unknown identity provider")
+
+var oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// OIDCProviderFromEnv returns the named provider if it is enabled in OIDC_PROVIDERS.
+func OIDCProviderFromEnv(name string) (*OIDCProvider, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	enabled := false
+	for _, p := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		if strings.EqualFold(strings.TrimSpace(p), name) && name != "" {
+			enabled = true
+			break
+		}
+	}
+	if !enabled {
+		return nil, ErrUnknownOIDCProvider
+	}
+
+	prefix := "OIDC_" + strings.ToUpper(name) + "_"
+	p := &OIDCProvider{
+		Name:         name,
+		Issuer:       strings.TrimRight(os.Getenv(prefix+"ISSUER"), "/"),
+		ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+		ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+		RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+		Scopes:       strings.Fields(envOr(prefix+"SCOPES", "openid email profile")),
+	}
+	if p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "" {
+		return nil, fmt.Errorf("provider %q is missing ISSUER, CLIENT_ID or REDIRECT_URL", name)
+	}
+	return p, nil
+}
+
+// NewPKCEVerifier returns a random PKCE code verifier (RFC 7636).
+func NewPKCEVerifier() (string, error) {
+	return randomToken(32)
+}
+
+// NewOIDCState returns a random value suitable for the state and nonce parameters.
+func NewOIDCState() (string, error) {
+	return randomToken(24)
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthorizationURL builds the URL the user is sent to in order to sign in.
+func (p *OIDCProvider) AuthorizationURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("scope", strings.Join(p.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", pkceChallenge(verifier))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified identity.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*OIDCIdentity, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", verifier)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d: %s %s", resp.StatusCode, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return p.VerifyIDToken(ctx, tokens.IDToken, nonce)
+}
+
+type idTokenClaims struct {
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	Name          string   `json:"name"`
+	Nonce         string   `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// flexBool accepts both true and "true"; some providers (Apple) send strings.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	*b = flexBool(s == "true")
+	return nil
+}
+
+// VerifyIDToken checks an ID token's signature against the provider's JWKS,
+// plus its issuer, audience, expiry and nonce.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, raw, nonce string) (*OIDCIdentity, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims idTokenClaims
+	_, err = jwt.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.verificationKey(ctx, meta.JWKSURI, kid, token.Method.Alg())
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("invalid ID token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid ID token: missing subject")
+	}
+
+	return &OIDCIdentity{
+		Subject:       claims.Subject,
+		Email:         strings.ToLower(claims.Email),
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
+
+// --- Discovery and JWKS, cached per issuer ---
+
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcCacheEntry struct {
+	meta      *oidcMetadata
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+const oidcCacheTTL = time.Hour
+
+var (
+	oidcCacheMu sync.Mutex
+	oidcCache   = map[string]*oidcCacheEntry{}
+)
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcMetadata, error) {
+	oidcCacheMu.Lock()
+	entry, ok := oidcCache[p.Issuer]
+	oidcCacheMu.Unlock()
+	if ok && time.Since(entry.fetchedAt) < oidcCacheTTL {
+		return entry.meta, nil
+	}
+
+	var meta oidcMetadata
+	if err := getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if strings.TrimRight(meta.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("OIDC discovery returned issuer %q, expected %q", meta.Issuer, p.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is incomplete")
+	}
+
+	oidcCacheMu.Lock()
+	oidcCache[p.Issuer] = &oidcCacheEntry{meta: &meta, fetchedAt: time.Now()}
+	oidcCacheMu.Unlock()
+	return &meta, nil
+}
+
+// verificationKey returns the provider key for kid, refetching the JWKS once
+// if the kid is unknown (the provider may have rotated its keys).
+func (p *OIDCProvider) verificationKey(ctx context.Context, jwksURI, kid, alg string) (crypto.PublicKey, error) {
+	oidcCacheMu.Lock()
+	entry := oidcCache[p.Issuer]
+	var cached map[string]crypto.PublicKey
+	if entry != nil {
+		cached = entry.keys
+	}
+	oidcCacheMu.Unlock()
+
+	key, ok := cached[kid]
+	if !ok {
+		var set JWKSet
+		if err := getJSON(ctx, jwksURI, &set); err != nil {
+			return nil, fmt.Errorf("fetching provider keys: %w", err)
+		}
+		fresh := map[string]crypto.PublicKey{}
+		for _, jwk := range set.Keys {
+			if pub, err := jwk.PublicKey(); err == nil {
+				fresh[jwk.Kid] = pub
+			}
+		}
+
+		oidcCacheMu.Lock()
+		if entry := oidcCache[p.Issuer]; entry != nil {
+			entry.keys = fresh
+		}
+		oidcCacheMu.Unlock()
+
+		if key, ok = fresh[kid]; !ok {
+			return nil, fmt.Errorf("unknown provider key %q", kid)
+		}
+	}
+
+	var matches bool
+	switch key.(type) {
+	case *rsa.PublicKey:
+		matches = alg == "RS256"
+	case *ecdsa.PublicKey:
+		matches = alg == "ES256"
+	case ed25519.PublicKey:
+		matches = alg == "EdDSA"
+	}
+	if !matches {
+		return nil, fmt.Errorf("algorithm %s does not match key %q", alg, kid)
+	}
+	return key, nil
+}
+
+func getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// PublicKey converts a JWK back into a Go public key.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
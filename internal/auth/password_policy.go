@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+//go:embed common_passwords.txt
+var bundledBlocklist []byte
+
+// PasswordPolicy is checked whenever a password is set. Configure it with
+// PASSWORD_MIN_LENGTH, PASSWORD_MIN_CLASSES (how many of lowercase, uppercase,
+// digits and symbols must appear), PASSWORD_REJECT_COMMON and
+// PASSWORD_BLOCKLIST_FILE.
+var PasswordPolicy = passwordPolicyFromEnv()
+
+// PasswordRules is a password policy, see PasswordPolicy.
+type PasswordRules struct {
+	MinLength    int
+	MaxLength    int
+	MinClasses   int
+	RejectCommon bool
+	// BlocklistFile replaces the bundled list of common passwords when set.
+	BlocklistFile string
+
+	once      sync.Once
+	blocklist map[string]bool
+}
+
+// PasswordPolicyError explains why a password was rejected. Its message is
+// safe to show to the user.
+type PasswordPolicyError struct {
+	Reason string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return e.Reason
+}
+
+func passwordPolicyFromEnv() *PasswordRules {
+	p := &PasswordRules{
+		MinLength:     8,
+		MaxLength:     72, // bcrypt ignores anything longer
+		MinClasses:    1,
+		RejectCommon:  os.Getenv("PASSWORD_REJECT_COMMON") != "false",
+		BlocklistFile: os.Getenv("PASSWORD_BLOCKLIST_FILE"),
+	}
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil && n > 0 {
+		p.MinLength = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_CLASSES")); err == nil && n >= 1 && n <= 4 {
+		p.MinClasses = n
+	}
+	return p
+}
+
+// ValidatePassword returns a *PasswordPolicyError if password doesn't meet the
+// policy. email is used to reject passwords that are just the user's address.
+func ValidatePassword(password, email string) error {
+	return PasswordPolicy.Validate(password, email)
+}
+
+func (p *PasswordRules) Validate(password, email string) error {
+	if len([]rune(password)) < p.MinLength {
+		return &PasswordPolicyError{fmt.Sprintf("Password must be at least %d characters", p.MinLength)}
+	}
+	if len(password) > p.MaxLength {
+		return &PasswordPolicyError{fmt.Sprintf("Password must be at most %d bytes", p.MaxLength)}
+	}
+	if classes := characterClasses(password); classes < p.MinClasses {
+		return &PasswordPolicyError{fmt.Sprintf(
+			"Password must contain at least %d of: lowercase letters, uppercase letters, digits, symbols", p.MinClasses)}
+	}
+
+	lower := strings.ToLower(password)
+	if local, _, ok := strings.Cut(strings.ToLower(email), "@"); ok && (lower == strings.ToLower(email) || lower == local) {
+		return &PasswordPolicyError{"Password must not be your email address"}
+	}
+	if p.RejectCommon && p.isCommon(lower) {
+		return &PasswordPolicyError{"This password is too common. Choose something harder to guess."}
+	}
+	return nil
+}
+
+// isCommon checks the password, and the password with trailing digits and
+// symbols removed ("Summer2024!" -> "summer"), against the blocklist.
+func (p *PasswordRules) isCommon(lower string) bool {
+	p.once.Do(p.loadBlocklist)
+	if p.blocklist[lower] {
+		return true
+	}
+	base := strings.TrimRightFunc(lower, func(r rune) bool {
+		return unicode.IsDigit(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+	})
+	return base != lower && p.blocklist[base]
+}
+
+func (p *PasswordRules) loadBlocklist() {
+	data := bundledBlocklist
+	if p.BlocklistFile != "" {
+		custom, err := os.ReadFile(p.BlocklistFile)
+		if err != nil {
+			log.Printf("Failed to read PASSWORD_BLOCKLIST_FILE, using the bundled list: %v", err)
+		} else {
+			data = custom
+		}
+	}
+
+	p.blocklist = map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.blocklist[strings.ToLower(line)] = true
+	}
+}
+
+func characterClasses(s string) int {
+	var lower, upper, digit, other bool
+	for _, r := range s {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	n := 0
+	for _, b := range []bool{lower, upper, digit, other} {
+		if b {
+			n++
+		}
+	}
+	return n
+}
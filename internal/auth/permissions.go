@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var ErrUnknownRole = errors.New("unknown role")
+
+// UserPermissions returns the union of the permissions granted by the user's roles.
+func UserPermissions(userID string) ([]string, error) {
+	var perms []string
+	err := database.DB.Model(&models.RolePermission{}).
+		Distinct("role_permissions.permission").
+		Joins("JOIN user_roles ON user_roles.role_name = role_permissions.role_name").
+		Where("user_roles.user_id = ?", userID).
+		Order("role_permissions.permission").
+		Pluck("role_permissions.permission", &perms).Error
+	return perms, err
+}
+
+// HasPermission reports whether any of the user's roles grants the permission.
+func HasPermission(userID, permission string) (bool, error) {
+	perms, err := UserPermissions(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range perms {
+		if p == permission {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SetUserRoles replaces the user's roles. It also keeps the legacy IsAdmin
+// flag in step with membership of the admin role.
+func SetUserRoles(userID string, roleNames []string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var roles []models.Role
+		if len(roleNames) > 0 {
+			if err := tx.Where("name IN ?", roleNames).Find(&roles).Error; err != nil {
+				return err
+			}
+		}
+		if len(roles) != len(uniqueStrings(roleNames)) {
+			return ErrUnknownRole
+		}
+
+		user := models.User{ID: userID}
+		if err := tx.Model(&user).Association("Roles").Replace(roles); err != nil {
+			return err
+		}
+
+		isAdmin := false
+		for _, r := range roles {
+			if r.Name == models.RoleAdmin {
+				isAdmin = true
+			}
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).Update("is_admin", isAdmin).Error
+	})
+}
+
+// SetAdminRole adds or removes the built-in admin role, leaving other roles alone.
+func SetAdminRole(userID string, admin bool) error {
+	var current []string
+	if err := database.DB.Table("user_roles").Where("user_id = ?", userID).Pluck("role_name", &current).Error; err != nil {
+		return err
+	}
+
+	names := []string{}
+	for _, name := range current {
+		if name != models.RoleAdmin {
+			names = append(names, name)
+		}
+	}
+	if admin {
+		names = append(names, models.RoleAdmin)
+	}
+	return SetUserRoles(userID, names)
+}
+
+// RequirePermission only lets through users whose roles grant every listed
+// permission. Privileged routes also need a session that passed two-factor
+// authentication, see AdminRequiresTwoFactor.
+func RequirePermission(perms ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("userID")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		granted, err := UserPermissions(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load permissions"})
+			c.Abort()
+			return
+		}
+		has := make(map[string]bool, len(granted))
+		for _, p := range granted {
+			has[p] = true
+		}
+		for _, p := range perms {
+			if !has[p] {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Missing permission: " + p})
+				c.Abort()
+				return
+			}
+		}
+
+		passed, err := TwoFactorSatisfied(c, userID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load two-factor status"})
+			c.Abort()
+			return
+		}
+		if !passed {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Admin access requires two-factor authentication. Enable it and log in again.",
+				"code":  "two_factor_required",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("permissions", granted)
+		c.Next()
+	}
+}
+
+// TwoFactorSatisfied reports whether the request may use privileged
+// permissions as far as two-factor authentication goes: the user has a second
+// factor and the session passed it, or AdminRequiresTwoFactor is off.
+// Handlers that grant extra powers by permission outside RequirePermission
+// must check it too.
+func TwoFactorSatisfied(c *gin.Context, userID string) (bool, error) {
+	if !AdminRequiresTwoFactor() {
+		return true, nil
+	}
+	var user models.User
+	if err := database.DB.Select("id", "totp_enabled").Where("id = ?", userID).First(&user).Error; err != nil {
+		return false, err
+	}
+	enrolled, err := HasSecondFactor(&user)
+	if err != nil {
+		return false, err
+	}
+	return enrolled && c.GetBool("twoFactorVerified"), nil
+}
+
+func uniqueStrings(in []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, s := range in {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
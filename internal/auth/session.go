@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrSessionRevoked      = errors.New("session is no longer active")
+)
+
+// lastSeenInterval limits how often a request bumps a session's LastSeenAt, so
+// that authenticated reads don't turn into a write per request.
+const lastSeenInterval = time.Minute
+
+// SessionInfo describes the device a session is being created for and how the
+// user authenticated.
+type SessionInfo struct {
+	DeviceName        string
+	UserAgent         string
+	IPAddress         string
+	TwoFactorVerified bool
+}
+
+// CreateSession starts a new session for the user and returns it together with
+// the plaintext refresh token. Only a hash of the token is persisted.
+func CreateSession(userID string, info SessionInfo) (*models.Session, string, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:                uuid.New().String(),
+		UserID:            userID,
+		RefreshTokenHash:  HashToken(secret),
+		DeviceName:        info.DeviceName,
+		UserAgent:         info.UserAgent,
+		IPAddress:         info.IPAddress,
+		TwoFactorVerified: info.TwoFactorVerified,
+		CreatedAt:         now,
+		LastSeenAt:        now,
+		ExpiresAt:         now.Add(RefreshTokenTTL),
+	}
+	if err := database.DB.Create(&session).Error; err != nil {
+		return nil, "", err
+	}
+
+	return &session, session.ID + "." + secret, nil
+}
+
+// RotateSession exchanges a refresh token for a new one. Presenting a refresh
+// token that has already been rotated revokes the whole session, since it means
+// the token has leaked.
+func RotateSession(refreshToken string, info SessionInfo) (*models.Session, string, error) {
+	sessionID, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || sessionID == "" || secret == "" {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	var session models.Session
+	if err := database.DB.Where("id = ?", sessionID).First(&session).Error; err != nil {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+
+	newSecret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	result := database.DB.Model(&models.Session{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", session.ID, HashToken(secret)).
+		Updates(map[string]interface{}{
+			"refresh_token_hash": HashToken(newSecret),
+			"user_agent":         info.UserAgent,
+			"ip_address":         info.IPAddress,
+			"last_seen_at":       now,
+			"expires_at":         now.Add(RefreshTokenTTL),
+		})
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		_ = RevokeSession(session.ID)
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	if err := database.DB.Where("id = ?", session.ID).First(&session).Error; err != nil {
+		return nil, "", err
+	}
+	return &session, session.ID + "." + newSecret, nil
+}
+
+// CheckSession loads the session an access token was issued for and verifies it
+// still belongs to the user and hasn't been revoked or expired.
+func CheckSession(sessionID, userID string) (*models.Session, error) {
+	if sessionID == "" {
+		return nil, ErrSessionRevoked
+	}
+
+	var session models.Session
+	if err := database.DB.Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		return nil, ErrSessionRevoked
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, ErrSessionRevoked
+	}
+	return &session, nil
+}
+
+// TouchSession records activity on a session, at most once per lastSeenInterval.
+func TouchSession(session *models.Session, ipAddress string) {
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) < lastSeenInterval && session.IPAddress == ipAddress {
+		return
+	}
+	_ = database.DB.Model(&models.Session{}).Where("id = ?", session.ID).Updates(map[string]interface{}{
+		"last_seen_at": now,
+		"ip_address":   ipAddress,
+	}).Error
+}
+
+// ListActiveSessions returns the user's sessions that can still be used, most recently active first.
+func ListActiveSessions(userID string) ([]models.Session, error) {
+	var sessions []models.Session
+	err := database.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at desc").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeUserSession revokes one of the user's sessions. It reports whether a
+// matching active session was found.
+func RevokeUserSession(userID, sessionID string) (bool, error) {
+	result := database.DB.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeOtherSessions revokes every active session of the user except keepSessionID
+// and returns how many were revoked. Pass an empty keepSessionID to revoke them all.
+func RevokeOtherSessions(userID, keepSessionID string) (int64, error) {
+	result := database.DB.Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepSessionID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// MarkSessionTwoFactorVerified records that the session's user has just passed a second factor.
+func MarkSessionTwoFactorVerified(sessionID string) error {
+	return database.DB.Model(&models.Session{}).Where("id = ?", sessionID).Update("two_factor_verified", true).Error
+}
+
+// RevokeSession invalidates a session so its refresh token can no longer be used.
+func RevokeSession(sessionID string) error {
+	return database.DB.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// HashToken returns the hex-encoded SHA-256 of an opaque token. High-entropy
+// tokens don't need a slow hash, and a deterministic one lets us look them up.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Purposes for single-use user tokens.
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeLoginChallenge    = "login_challenge"
+	TokenPurposeMagicLink         = "magic_link"
+)
+
+var ErrInvalidUserToken = errors.New("invalid or expired token")
+
+// maxUserTokenAttempts is how many wrong codes may be entered against one token
+// (e.g. a login challenge) before it is burned.
+const maxUserTokenAttempts = 5
+
+// IssueUserToken creates a single-use token for the given purpose and returns
+// its plaintext value. Any earlier unused token with the same purpose is
+// invalidated, so only the most recent email link works.
+func IssueUserToken(userID, purpose string, ttl time.Duration) (string, error) {
+	plaintext, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", now).Error; err != nil {
+		return "", err
+	}
+
+	token := models.UserToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: HashToken(plaintext),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if err := database.DB.Create(&token).Error; err != nil {
+		return "", err
+	}
+	return plaintext, nil
+}
+
+// ConsumeUserToken marks a token as used and returns it. It fails if the token
+// doesn't exist, has a different purpose, has expired or was already used.
+func ConsumeUserToken(plaintext, purpose string) (*models.UserToken, error) {
+	var token models.UserToken
+	if err := database.DB.Where("token_hash = ? AND purpose = ?", HashToken(plaintext), purpose).First(&token).Error; err != nil {
+		return nil, ErrInvalidUserToken
+	}
+
+	now := time.Now()
+	result := database.DB.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", token.ID, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidUserToken
+	}
+
+	token.UsedAt = &now
+	return &token, nil
+}
+
+// LookupUserToken returns a token that is still usable without consuming it.
+func LookupUserToken(plaintext, purpose string) (*models.UserToken, error) {
+	var token models.UserToken
+	if err := database.DB.
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", HashToken(plaintext), purpose, time.Now()).
+		First(&token).Error; err != nil {
+		return nil, ErrInvalidUserToken
+	}
+	return &token, nil
+}
+
+// RecordUserTokenFailure counts a wrong code entered against the token and
+// burns it once maxUserTokenAttempts is reached.
+func RecordUserTokenFailure(tokenID string) error {
+	if err := database.DB.Model(&models.UserToken{}).
+		Where("id = ?", tokenID).
+		Update("attempts", gorm.Expr("attempts + 1")).Error; err != nil {
+		return err
+	}
+	return database.DB.Model(&models.UserToken{}).
+		Where("id = ? AND attempts >= ? AND used_at IS NULL", tokenID, maxUserTokenAttempts).
+		Update("used_at", time.Now()).Error
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"crypto/rand"
+	"os"
+	"strings"
+	"time"
+
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const recoveryCodeCount = 10
+
+// AdminRequiresTwoFactor reports whether admin routes demand a session that
+// passed two-factor authentication. On by default; set ADMIN_REQUIRE_2FA=false
+// to turn it off (e.g. for local development).
+func AdminRequiresTwoFactor() bool {
+	return os.Getenv("ADMIN_REQUIRE_2FA") != "false"
+}
+
+// HasSecondFactor reports whether the user has enrolled TOTP or registered a
+// WebAuthn credential.
+func HasSecondFactor(user *models.User) (bool, error) {
+	if user.TOTPEnabled {
+		return true, nil
+	}
+	var count int64
+	err := database.DB.Model(&models.WebAuthnCredential{}).Where("user_id = ?", user.ID).Count(&count).Error
+	return count > 0, err
+}
+
+// VerifyUserTOTP checks a code against the user's TOTP secret. A code is
+// accepted only once, even within its validity window.
+func VerifyUserTOTP(user *models.User, code string) bool {
+	if user.TOTPSecret == "" {
+		return false
+	}
+
+	counter, ok := MatchTOTP(user.TOTPSecret, code, time.Now())
+	if !ok || counter <= user.TOTPLastCounter {
+		return false
+	}
+
+	result := database.DB.Model(&models.User{}).
+		Where("id = ? AND totp_last_counter < ?", user.ID, counter).
+		Update("totp_last_counter", counter)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	user.TOTPLastCounter = counter
+	return true
+}
+
+// GenerateRecoveryCodes replaces the user's recovery codes and returns the new
+// plaintext codes. They are shown to the user once and only hashes are kept.
+func GenerateRecoveryCodes(userID string) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]models.RecoveryCode, recoveryCodeCount)
+	now := time.Now()
+	for i := range codes {
+		code, err := randomRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		rows[i] = models.RecoveryCode{
+			ID:        uuid.New().String(),
+			UserID:    userID,
+			CodeHash:  HashToken(normalizeRecoveryCode(code)),
+			CreatedAt: now,
+		}
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode consumes one of the user's recovery codes.
+func UseRecoveryCode(userID, code string) bool {
+	result := database.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+// RecoveryCodesRemaining counts the user's unused recovery codes.
+func RecoveryCodesRemaining(userID string) (int64, error) {
+	var count int64
+	err := database.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+// DeleteRecoveryCodes removes all of the user's recovery codes.
+func DeleteRecoveryCodes(userID string) error {
+	return database.DB.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+}
+
+// randomRecoveryCode returns a code like "k7d2m-q9xw4", avoiding look-alike characters.
+func randomRecoveryCode() (string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"net/http"
+	"os"
+
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Feature scopes that can be restricted to accounts with a verified email.
+const (
+	VerificationScopeAI  = "ai"
+	VerificationScopeAll = "all"
+)
+
+// EmailVerificationPolicy returns which features require a verified email,
+// configured via EMAIL_VERIFICATION_POLICY:
+//   - "off": nothing is restricted
+//   - "ai" (default): AI endpoints are restricted
+//   - "all": every data endpoint is restricted; only account endpoints stay open
+func EmailVerificationPolicy() string {
+	switch p := os.Getenv("EMAIL_VERIFICATION_POLICY"); p {
+	case "off", VerificationScopeAll:
+		return p
+	default:
+		return VerificationScopeAI
+	}
+}
+
+func policyCovers(policy, scope string) bool {
+	switch policy {
+	case VerificationScopeAll:
+		return true
+	case VerificationScopeAI:
+		return scope == VerificationScopeAI
+	default:
+		return false
+	}
+}
+
+// RequireVerifiedEmail blocks unverified accounts from routes in the given
+// scope when the configured policy covers it.
+func RequireVerifiedEmail(scope string) gin.HandlerFunc {
+	enforced := policyCovers(EmailVerificationPolicy(), scope)
+
+	return func(c *gin.Context) {
+		if !enforced || c.GetBool("emailVerified") {
+			c.Next()
+			return
+		}
+
+		var user models.User
+		if err := database.DB.Select("email_verified").Where("id = ?", c.GetString("userID")).First(&user).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+
+		if !user.EmailVerified {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email address first", "code": "email_not_verified"})
+			c.Abort()
+			return
+		}
+
+		c.Set("emailVerified", true)
+		c.Next()
+	}
+}
@@ -0,0 +1,439 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/models"
+)
+
+// WebAuthn relying party settings. WEBAUTHN_RP_ID must be the domain the app
+// is served from (or a parent of it) and WEBAUTHN_ORIGINS the exact origins
+// the browser reports, comma-separated.
+var (
+	WebAuthnRPID    = envOr("WEBAUTHN_RP_ID", "localhost")
+	WebAuthnRPName  = envOr("WEBAUTHN_RP_NAME", "IronTrack")
+	WebAuthnOrigins = webAuthnOriginsFromEnv()
+)
+
+// WebAuthnCeremonyTTL is how long the browser has to answer a challenge.
+const WebAuthnCeremonyTTL = 5 * time.Minute
+
+// Purposes for WebAuthn ceremonies.
+const (
+	WebAuthnPurposeRegistration = "registration"
+	WebAuthnPurposeLogin        = "login"
+	WebAuthnPurposeSecondFactor = "second_factor"
+)
+
+// COSE algorithm identifiers we accept.
+const (
+	coseAlgES256 = -7
+	coseAlgEdDSA = -8
+	coseAlgRS256 = -257
+)
+
+var (
+	ErrWebAuthnCeremony  = errors.New("webauthn ceremony not found or expired")
+	ErrWebAuthnInvalid   = errors.New("webauthn response is invalid")
+	ErrWebAuthnSignCount = errors.New("webauthn signature counter went backwards")
+	ErrUnknownCredential = errors.New("unknown webauthn credential")
+)
+
+// Authenticator data flags.
+const (
+	authFlagUserPresent  = 0x01
+	authFlagUserVerified = 0x04
+	authFlagAttested     = 0x40
+)
+
+func webAuthnOriginsFromEnv() []string {
+	if v := os.Getenv("WEBAUTHN_ORIGINS"); v != "" {
+		return strings.Split(v, ",")
+	}
+	return []string{strings.TrimRight(envOr("APP_BASE_URL", "http://localhost:5173"), "/")}
+}
+
+// Options sent to navigator.credentials.create/get. Binary fields are base64url.
+
+type WebAuthnCredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type WebAuthnCreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []WebAuthnCredentialParam      `json:"pubKeyCredParams"`
+	Timeout                int64                          `json:"timeout"`
+	Attestation            string                         `json:"attestation"`
+	ExcludeCredentials     []WebAuthnCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection map[string]string              `json:"authenticatorSelection"`
+}
+
+type WebAuthnCredentialParam struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type WebAuthnRequestOptions struct {
+	Challenge        string                         `json:"challenge"`
+	RPID             string                         `json:"rpId"`
+	Timeout          int64                          `json:"timeout"`
+	AllowCredentials []WebAuthnCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                         `json:"userVerification"`
+}
+
+// NewWebAuthnCreationOptions builds registration options for the user. Their
+// existing credentials are excluded so the same authenticator isn't added twice.
+func NewWebAuthnCreationOptions(user models.User, challenge string, existing []models.WebAuthnCredential) WebAuthnCreationOptions {
+	opts := WebAuthnCreationOptions{
+		Challenge: challenge,
+		PubKeyCredParams: []WebAuthnCredentialParam{
+			{Type: "public-key", Alg: coseAlgES256},
+			{Type: "public-key", Alg: coseAlgEdDSA},
+			{Type: "public-key", Alg: coseAlgRS256},
+		},
+		Timeout:     WebAuthnCeremonyTTL.Milliseconds(),
+		Attestation: "none",
+		AuthenticatorSelection: map[string]string{
+			"residentKey":      "preferred",
+			"userVerification": "preferred",
+		},
+		ExcludeCredentials: credentialDescriptors(existing),
+	}
+	opts.RP.ID = WebAuthnRPID
+	opts.RP.Name = WebAuthnRPName
+	opts.User.ID = base64.RawURLEncoding.EncodeToString([]byte(user.ID))
+	opts.User.Name = user.Email
+	opts.User.DisplayName = user.Name
+	return opts
+}
+
+// NewWebAuthnRequestOptions builds login options. With no allowed credentials
+// the browser offers any passkey it has for this site.
+func NewWebAuthnRequestOptions(challenge string, allowed []models.WebAuthnCredential, userVerification string) WebAuthnRequestOptions {
+	return WebAuthnRequestOptions{
+		Challenge:        challenge,
+		RPID:             WebAuthnRPID,
+		Timeout:          WebAuthnCeremonyTTL.Milliseconds(),
+		AllowCredentials: credentialDescriptors(allowed),
+		UserVerification: userVerification,
+	}
+}
+
+func credentialDescriptors(creds []models.WebAuthnCredential) []WebAuthnCredentialDescriptor {
+	out := make([]WebAuthnCredentialDescriptor, len(creds))
+	for i, cred := range creds {
+		out[i] = WebAuthnCredentialDescriptor{Type: "public-key", ID: cred.CredentialID}
+	}
+	return out
+}
+
+// BeginWebAuthnCeremony stores a fresh challenge. userID is empty for
+// passkey logins, where the user is only known once they answer.
+func BeginWebAuthnCeremony(userID, purpose string) (*models.WebAuthnCeremony, error) {
+	challenge, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	id, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	// Clear out ceremonies the browser never finished
+	database.DB.Where("expires_at < ?", now).Delete(&models.WebAuthnCeremony{})
+
+	ceremony := models.WebAuthnCeremony{
+		ID:        id,
+		UserID:    userID,
+		Purpose:   purpose,
+		Challenge: challenge,
+		ExpiresAt: now.Add(WebAuthnCeremonyTTL),
+		CreatedAt: now,
+	}
+	if err := database.DB.Create(&ceremony).Error; err != nil {
+		return nil, err
+	}
+	return &ceremony, nil
+}
+
+// ConsumeWebAuthnCeremony loads and deletes a ceremony; each challenge can be answered once.
+func ConsumeWebAuthnCeremony(id, purpose string) (*models.WebAuthnCeremony, error) {
+	var ceremony models.WebAuthnCeremony
+	if err := database.DB.Where("id = ? AND purpose = ?", id, purpose).First(&ceremony).Error; err != nil {
+		return nil, ErrWebAuthnCeremony
+	}
+	result := database.DB.Where("id = ?", id).Delete(&models.WebAuthnCeremony{})
+	if result.Error != nil || result.RowsAffected == 0 || time.Now().After(ceremony.ExpiresAt) {
+		return nil, ErrWebAuthnCeremony
+	}
+	return &ceremony, nil
+}
+
+// WebAuthnAttestation is the newly created credential extracted from a
+// registration response.
+type WebAuthnAttestation struct {
+	CredentialID []byte
+	PublicKey    []byte // COSE_Key
+	SignCount    uint32
+	UserVerified bool
+}
+
+// VerifyWebAuthnRegistration checks a navigator.credentials.create() response
+// against the challenge. Attestation statements are not verified; we ask for
+// "none" and trust the credential the browser hands us.
+func VerifyWebAuthnRegistration(challenge string, clientDataJSON, attestationObject []byte) (*WebAuthnAttestation, error) {
+	if err := verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	obj, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnInvalid, err)
+	}
+	m, ok := obj.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrWebAuthnInvalid
+	}
+	authData, ok := m["authData"].([]byte)
+	if !ok {
+		return nil, ErrWebAuthnInvalid
+	}
+
+	flags, signCount, rest, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if flags&authFlagAttested == 0 {
+		return nil, fmt.Errorf("%w: no attested credential data", ErrWebAuthnInvalid)
+	}
+
+	// aaguid (16) | credential id length (2) | credential id | COSE key
+	if len(rest) < 18 {
+		return nil, ErrWebAuthnInvalid
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+		return nil, ErrWebAuthnInvalid
+	}
+	credentialID := append([]byte(nil), rest[:idLen]...)
+	rest = rest[idLen:]
+
+	_, after, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnInvalid, err)
+	}
+	publicKey := append([]byte(nil), rest[:len(rest)-len(after)]...)
+	if _, _, err := parseCOSEKey(publicKey); err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnAttestation{
+		CredentialID: credentialID,
+		PublicKey:    publicKey,
+		SignCount:    signCount,
+		UserVerified: flags&authFlagUserVerified != 0,
+	}, nil
+}
+
+// VerifyWebAuthnAssertion checks a navigator.credentials.get() response made
+// with cred and returns the authenticator's new signature counter. Primary
+// logins pass requireUV so a stolen security key alone isn't enough.
+func VerifyWebAuthnAssertion(challenge string, cred *models.WebAuthnCredential, clientDataJSON, authenticatorData, signature []byte, requireUV bool) (uint32, error) {
+	if err := verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	flags, signCount, _, err := parseAuthenticatorData(authenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	if requireUV && flags&authFlagUserVerified == 0 {
+		return 0, fmt.Errorf("%w: user verification required", ErrWebAuthnInvalid)
+	}
+
+	pub, alg, err := parseCOSEKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authenticatorData...), clientDataHash[:]...)
+	if !verifyCOSESignature(pub, alg, signed, signature) {
+		return 0, fmt.Errorf("%w: bad signature", ErrWebAuthnInvalid)
+	}
+
+	// Authenticators that keep a counter must increase it; a lower value means
+	// the credential may have been cloned.
+	if (signCount != 0 || cred.SignCount != 0) && signCount <= cred.SignCount {
+		return 0, ErrWebAuthnSignCount
+	}
+	return signCount, nil
+}
+
+// DecodeWebAuthnBase64 accepts base64url with or without padding, as sent by browsers.
+func DecodeWebAuthnBase64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func verifyClientData(clientDataJSON []byte, wantType, challenge string) error {
+	var cd struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return fmt.Errorf("%w: client data: %v", ErrWebAuthnInvalid, err)
+	}
+	if cd.Type != wantType {
+		return fmt.Errorf("%w: unexpected type %q", ErrWebAuthnInvalid, cd.Type)
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.TrimRight(cd.Challenge, "=")), []byte(challenge)) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrWebAuthnInvalid)
+	}
+	for _, origin := range WebAuthnOrigins {
+		if cd.Origin == strings.TrimSpace(origin) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: origin %q not allowed", ErrWebAuthnInvalid, cd.Origin)
+}
+
+// parseAuthenticatorData checks the RP ID hash and user presence and returns
+// the flags, the signature counter and whatever follows them.
+func parseAuthenticatorData(data []byte) (byte, uint32, []byte, error) {
+	if len(data) < 37 {
+		return 0, 0, nil, fmt.Errorf("%w: authenticator data too short", ErrWebAuthnInvalid)
+	}
+	rpIDHash := sha256.Sum256([]byte(WebAuthnRPID))
+	if !bytes.Equal(data[:32], rpIDHash[:]) {
+		return 0, 0, nil, fmt.Errorf("%w: RP ID mismatch", ErrWebAuthnInvalid)
+	}
+	flags := data[32]
+	if flags&authFlagUserPresent == 0 {
+		return 0, 0, nil, fmt.Errorf("%w: user presence flag not set", ErrWebAuthnInvalid)
+	}
+	return flags, binary.BigEndian.Uint32(data[33:37]), data[37:], nil
+}
+
+// parseCOSEKey decodes a COSE_Key (RFC 9053) into a Go public key.
+func parseCOSEKey(data []byte) (crypto.PublicKey, int64, error) {
+	v, _, err := decodeCBOR(data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: public key: %v", ErrWebAuthnInvalid, err)
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: public key is not a map", ErrWebAuthnInvalid)
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == coseAlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			break
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			break
+		}
+		return pub, alg, nil
+	case kty == 1 && alg == coseAlgEdDSA:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			break
+		}
+		return ed25519.PublicKey(x), alg, nil
+	case kty == 3 && alg == coseAlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			break
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, alg, nil
+	}
+	return nil, 0, fmt.Errorf("%w: unsupported public key (kty %d, alg %d)", ErrWebAuthnInvalid, kty, alg)
+}
+
+func verifyCOSESignature(pub crypto.PublicKey, alg int64, data, sig []byte) bool {
+	switch alg {
+	case coseAlgES256:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(pub.(*ecdsa.PublicKey), digest[:], sig)
+	case coseAlgEdDSA:
+		return ed25519.Verify(pub.(ed25519.PublicKey), data, sig)
+	case coseAlgRS256:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), crypto.SHA256, digest[:], sig) == nil
+	}
+	return false
+}
+
+// WebAuthnCredentials returns the user's registered credentials, oldest first.
+func WebAuthnCredentials(userID string) ([]models.WebAuthnCredential, error) {
+	var creds []models.WebAuthnCredential
+	err := database.DB.Where("user_id = ?", userID).Order("created_at asc").Find(&creds).Error
+	return creds, err
+}
+
+// FindWebAuthnCredential looks up a credential by the base64url ID the browser reports.
+func FindWebAuthnCredential(credentialID string) (*models.WebAuthnCredential, error) {
+	var cred models.WebAuthnCredential
+	if err := database.DB.Where("credential_id = ?", strings.TrimRight(credentialID, "=")).First(&cred).Error; err != nil {
+		return nil, ErrUnknownCredential
+	}
+	return &cred, nil
+}
+
+// RecordWebAuthnUse stores the new signature counter after a successful
+// assertion. The update is conditional so two racing logins can't both use
+// the same counter value.
+func RecordWebAuthnUse(cred *models.WebAuthnCredential, signCount uint32) error {
+	query := database.DB.Model(&models.WebAuthnCredential{}).Where("id = ?", cred.ID)
+	if signCount != 0 {
+		query = query.Where("sign_count < ?", signCount)
+	}
+	result := query.Updates(map[string]interface{}{
+		"sign_count":   signCount,
+		"last_used_at": time.Now(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWebAuthnSignCount
+	}
+	return nil
+}
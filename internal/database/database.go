@@ -69,11 +69,23 @@ func ConnectDatabase(dsn string) {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
+	// Accounts created before email verification existed are grandfathered in
+	// as verified, otherwise the new policy would lock them out.
+	backfillVerifiedEmails := DB.Migrator().HasTable(&models.User{}) &&
+		!DB.Migrator().HasColumn(&models.User{}, "EmailVerified")
+
+	// Roles replaced the IsAdmin flag; existing admins get the admin role the
+	// first time the roles tables are created.
+	migrateAdminsToRoles := DB.Migrator().HasTable(&models.User{}) &&
+		!DB.Migrator().HasTable(&models.Role{})
+
 	// Auto Migrate the schema
 	log.Println("Migrating database schema...")
 	err = DB.AutoMigrate(
 		&models.User{},
 		&models.UserProfile{},
+		&models.Role{},
+		&models.RolePermission{},
 		&models.ExerciseDefinition{},
 		&models.WorkoutPlan{},
 		&models.PlanExercise{},
@@ -81,13 +93,69 @@ func ConnectDatabase(dsn string) {
 		&models.LogExercise{},
 		&models.LogSet{},
 		&models.AIRequestLog{},
+		&models.Session{},
+		&models.UserToken{},
+		&models.RecoveryCode{},
+		&models.UserIdentity{},
+		&models.OAuthState{},
+		&models.PersonalAccessToken{},
+		&models.LoginAttempt{},
+		&models.WebAuthnCredential{},
+		&models.WebAuthnCeremony{},
+		&models.Impersonation{},
+		&models.ImpersonationRequest{},
+		&models.Program{},
+		&models.ProgramWeek{},
+		&models.ProgramDay{},
+		&models.ProgramProgress{},
 	)
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
+
+	// A user has at most one live workout session. The index backs that up
+	// when two devices start one at the same moment.
+	if err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_workout_logs_open_session ON workout_logs (user_id) WHERE status = 'in_progress'").Error; err != nil {
+		log.Fatal("Failed to create open workout index:", err)
+	}
+
+	if backfillVerifiedEmails {
+		if err := DB.Exec("UPDATE users SET email_verified = ?, email_verified_at = created_at", true).Error; err != nil {
+			log.Fatal("Failed to backfill verified emails:", err)
+		}
+	}
+
+	if err := seedBuiltinRoles(); err != nil {
+		log.Fatal("Failed to seed roles:", err)
+	}
+	if migrateAdminsToRoles {
+		if err := DB.Exec("INSERT INTO user_roles (user_id, role_name) SELECT id, ? FROM users WHERE is_admin = ?",
+			models.RoleAdmin, true).Error; err != nil {
+			log.Fatal("Failed to migrate admins to roles:", err)
+		}
+	}
 	log.Println("Database migration completed.")
 }
 
+// seedBuiltinRoles creates the built-in roles and resets their permissions to
+// the ones defined in code.
+func seedBuiltinRoles() error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for _, role := range models.BuiltinRoles {
+			if err := tx.Save(&models.Role{Name: role.Name, Description: role.Description, BuiltIn: true}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("role_name = ?", role.Name).Delete(&models.RolePermission{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&role.Permissions).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func InitDatabase() {
 	ConnectDatabase("")
 }
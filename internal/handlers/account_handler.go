@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"irontrack-backend/internal/account"
+	"irontrack-backend/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DeleteAccountRequest struct {
+	// Password confirms the request. Accounts without a password confirm by
+	// typing their email address instead.
+	Password     string `json:"password"`
+	ConfirmEmail string `json:"confirmEmail"`
+}
+
+// ExportAccount returns a JSON archive of everything stored about the caller.
+func ExportAccount(c *gin.Context) {
+	export, err := account.BuildExport(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export account"})
+		return
+	}
+
+	filename := fmt.Sprintf("irontrack-export-%s.json", export.ExportedAt.Format("2006-01-02"))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.JSON(http.StatusOK, export)
+}
+
+// RequestAccountDeletion schedules the caller's account to be purged after
+// account.DeletionGrace. Every other device and all access tokens are logged
+// out right away; logging in again during the grace period is allowed so the
+// request can be cancelled.
+func RequestAccountDeletion(c *gin.Context) {
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if user.Password != "" {
+		if req.Password == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "password is required"})
+			return
+		}
+		if !checkCurrentPassword(c, &user, req.Password) {
+			return
+		}
+	} else if !strings.EqualFold(strings.TrimSpace(req.ConfirmEmail), user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "confirmEmail must match your email address"})
+		return
+	}
+
+	at, err := account.ScheduleDeletion(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule account deletion"})
+		return
+	}
+	if _, err := auth.RevokeOtherSessions(user.ID, c.GetString("sessionID")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	if err := auth.RevokeAllPersonalAccessTokens(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke access tokens"})
+		return
+	}
+
+	sendMail(user.Email, "Your IronTrack account will be deleted", fmt.Sprintf(
+		"Hi %s,\n\nWe received a request to delete your IronTrack account. It and all of your data "+
+			"will be permanently deleted on %s.\n\nChanged your mind? Log in and cancel the deletion "+
+			"from your account settings before then.\n",
+		user.Name, at.UTC().Format("January 2, 2006 15:04 MST")))
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":             "Account deletion scheduled",
+		"deletionScheduledAt": at,
+	})
+}
+
+// CancelAccountDeletion withdraws a pending deletion request.
+func CancelAccountDeletion(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	if err := account.CancelDeletion(user.ID); err != nil {
+		if errors.Is(err, account.ErrDeletionNotScheduled) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Account deletion is not scheduled"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel account deletion"})
+		return
+	}
+
+	sendMail(user.Email, "Your IronTrack account will not be deleted", fmt.Sprintf(
+		"Hi %s,\n\nThe request to delete your IronTrack account has been cancelled. Nothing else changes.\n",
+		user.Name))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deletion cancelled"})
+}
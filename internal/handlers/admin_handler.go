@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 	"time"
 
+	"irontrack-backend/internal/auth"
 	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/loginguard"
 	"irontrack-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -42,7 +45,7 @@ func AdminSummary(c *gin.Context) {
 
 func AdminListUsers(c *gin.Context) {
 	var users []models.User
-	if err := database.DB.Order("created_at desc").Find(&users).Error; err != nil {
+	if err := database.DB.Preload("Roles").Order("created_at desc").Find(&users).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load users"})
 		return
 	}
@@ -52,7 +55,7 @@ func AdminListUsers(c *gin.Context) {
 type AdminCreateUserRequest struct {
 	Name     string `json:"name" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"`
 	IsAdmin  bool   `json:"isAdmin"`
 }
 
@@ -63,6 +66,13 @@ func AdminCreateUser(c *gin.Context) {
 		return
 	}
 
+	if req.IsAdmin && !requireRoleManager(c) {
+		return
+	}
+	if !validateNewPassword(c, req.Password, req.Email) {
+		return
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
@@ -74,7 +84,6 @@ func AdminCreateUser(c *gin.Context) {
 		Name:      req.Name,
 		Email:     req.Email,
 		Password:  string(hashedPassword),
-		IsAdmin:   req.IsAdmin,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -84,13 +93,21 @@ func AdminCreateUser(c *gin.Context) {
 		return
 	}
 
+	if req.IsAdmin {
+		if err := auth.SetAdminRole(user.ID, true); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign admin role"})
+			return
+		}
+		user.IsAdmin = true
+	}
+
 	c.JSON(http.StatusCreated, user)
 }
 
 type AdminUpdateUserRequest struct {
 	Name     *string `json:"name"`
 	Email    *string `json:"email" binding:"omitempty,email"`
-	Password *string `json:"password" binding:"omitempty,min=6"`
+	Password *string `json:"password"`
 	IsAdmin  *bool   `json:"isAdmin"`
 }
 
@@ -102,6 +119,10 @@ func AdminUpdateUser(c *gin.Context) {
 		return
 	}
 
+	if req.IsAdmin != nil && !requireRoleManager(c) {
+		return
+	}
+
 	var user models.User
 	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -111,10 +132,17 @@ func AdminUpdateUser(c *gin.Context) {
 	if req.Name != nil {
 		user.Name = *req.Name
 	}
-	if req.Email != nil {
+	emailChanged := req.Email != nil && *req.Email != user.Email
+	if emailChanged {
+		// The new address has to be confirmed like any other
 		user.Email = *req.Email
+		user.EmailVerified = false
+		user.EmailVerifiedAt = nil
 	}
 	if req.Password != nil {
+		if !validateNewPassword(c, *req.Password, user.Email) {
+			return
+		}
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
@@ -122,16 +150,27 @@ func AdminUpdateUser(c *gin.Context) {
 		}
 		user.Password = string(hashedPassword)
 	}
-	if req.IsAdmin != nil {
-		user.IsAdmin = *req.IsAdmin
-	}
 	user.UpdatedAt = time.Now()
 
-	if err := database.DB.Save(&user).Error; err != nil {
+	if err := database.DB.Omit("is_admin").Save(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
 
+	if req.IsAdmin != nil {
+		if err := auth.SetAdminRole(user.ID, *req.IsAdmin); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update admin role"})
+			return
+		}
+		user.IsAdmin = *req.IsAdmin
+	}
+
+	if emailChanged {
+		if err := sendVerificationEmail(user); err != nil {
+			log.Printf("Failed to send verification email to %s: %v", user.ID, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, user)
 }
 
@@ -141,12 +180,21 @@ func AdminDeleteUser(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
+	// Access tokens are only checked against their session, so end them all
+	if _, err := auth.RevokeOtherSessions(userID, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	if err := auth.RevokeAllPersonalAccessTokens(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke access tokens"})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
 }
 
 func AdminListPlans(c *gin.Context) {
 	var plans []models.WorkoutPlan
-	if err := database.DB.Preload("Exercises").Order("created_at desc").Find(&plans).Error; err != nil {
+	if err := database.DB.Preload("Exercises", orderPlanExercises).Order("created_at desc").Find(&plans).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load plans"})
 		return
 	}
@@ -171,6 +219,10 @@ func AdminCreatePlan(c *gin.Context) {
 	if plan.CreatedAt.IsZero() {
 		plan.CreatedAt = time.Now()
 	}
+	if err := preparePlanExercises(plan.Exercises); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	if err := database.DB.Create(&plan).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create plan"})
@@ -204,6 +256,7 @@ type AdminExerciseRequest struct {
 	Instructions string  `json:"instructions"`
 	UserID       *string `json:"userId"`
 	IsGlobal     bool    `json:"isGlobal"`
+	TrackingType string  `json:"trackingType"`
 }
 
 func AdminCreateExercise(c *gin.Context) {
@@ -219,6 +272,10 @@ func AdminCreateExercise(c *gin.Context) {
 		MuscleGroup:  req.MuscleGroup,
 		Instructions: req.Instructions,
 		IsGlobal:     req.IsGlobal,
+		TrackingType: req.TrackingType,
+	}
+	if !normalizeTrackingType(c, &exercise) {
+		return
 	}
 
 	if !req.IsGlobal {
@@ -261,3 +318,29 @@ func AdminListAIRequests(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, logs)
 }
+
+// AdminListLoginAttempts shows accounts and IPs with recent failed logins,
+// including any that are locked out.
+func AdminListLoginAttempts(c *gin.Context) {
+	entries, err := loginguard.Default().Active()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load login attempts"})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// AdminUnlockLogin clears the failed-login counter for a key such as
+// "account:jane@example.com" or "ip:203.0.113.7".
+func AdminUnlockLogin(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key is required"})
+		return
+	}
+	if err := loginguard.Default().Unlock(key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Unlocked"})
+}
@@ -50,7 +50,7 @@ func GenerateWorkoutPlan(c *gin.Context) {
 
 	model := client.GenerativeModel("gemini-2.5-flash")
 	model.ResponseMIMEType = "application/json"
-	model.SystemInstruction = genai.NewUserContent(genai.Text("You are an expert fitness coach. Create structured, safe, and effective workout plans tailored to the user's biometrics and goals. Output JSON matching the schema: {name, description, targetGoal, exercises: [{name, defaultSets (int), defaultReps (int), muscleGroup, instructions}]}. IMPORTANT: defaultSets and defaultReps must be strictly integers, not strings or ranges."))
+	model.SystemInstruction = genai.NewUserContent(genai.Text("You are an expert fitness coach. Create structured, safe, and effective workout plans tailored to the user's biometrics and goals. Output JSON matching the schema: {name, description, targetGoal, exercises: [{name, defaultSets (int), defaultReps (int), muscleGroup, instructions, restSeconds (int), groupId, groupType, warmupSets (int), targetRpe (number from 1 to 10 in steps of 0.5), tempo}]}. Exercises are listed in the order they are performed. To pair exercises as a superset (2 exercises), circuit (2 or more) or giant set (3 or more), give them the same short groupId (e.g. \"A\"), list them next to each other and set groupType to \"superset\", \"circuit\" or \"giant_set\" with the same restSeconds; leave groupId and groupType empty otherwise. Tempo, if given, is four phases like \"31X0\". IMPORTANT: defaultSets, defaultReps, restSeconds and warmupSets must be strictly integers, not strings or ranges."))
 
 	languageInstruction := ""
 	if req.Language != "" {
@@ -121,6 +121,17 @@ func GenerateWorkoutPlan(c *gin.Context) {
 	plan.UserID = userID
 	plan.IsAiGenerated = true
 	plan.CreatedAt = time.Now()
+	if err := preparePlanExercises(plan.Exercises); err != nil {
+		// Keep the exercises, just drop grouping, rest times and targets the model got wrong
+		for i := range plan.Exercises {
+			plan.Exercises[i].ExerciseGrouping = models.ExerciseGrouping{}
+			plan.Exercises[i].ExerciseTargets = models.ExerciseTargets{}
+		}
+		if err := preparePlanExercises(plan.Exercises); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid plan from AI: " + err.Error()})
+			return
+		}
+	}
 
 	logAIRequest(userID, "generate_plan")
 
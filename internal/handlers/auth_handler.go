@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"irontrack-backend/internal/auth"
 	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/loginguard"
 	"irontrack-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -14,19 +18,99 @@ import (
 )
 
 type RegisterRequest struct {
-	Name     string `json:"name" binding:"required"`
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Name       string `json:"name" binding:"required"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required"`
+	DeviceName string `json:"deviceName"`
 }
 
 type LoginRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required"`
+	DeviceName string `json:"deviceName"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
 }
 
 type AuthResponse struct {
-	Token string      `json:"token"`
-	User  models.User `json:"user"`
+	Token        string      `json:"token"`
+	RefreshToken string      `json:"refreshToken"`
+	ExpiresAt    time.Time   `json:"expiresAt"`
+	User         models.User `json:"user"`
+}
+
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool     `json:"twoFactorRequired"`
+	ChallengeToken    string   `json:"challengeToken"`
+	Methods           []string `json:"methods"`
+}
+
+const loginChallengeTTL = 5 * time.Minute
+
+func sessionInfo(c *gin.Context, deviceName string) auth.SessionInfo {
+	return auth.SessionInfo{
+		DeviceName: deviceName,
+		UserAgent:  c.Request.UserAgent(),
+		IPAddress:  c.ClientIP(),
+	}
+}
+
+// newAuthResponse starts a session for the user and returns a fresh access and refresh token pair.
+func newAuthResponse(user models.User, info auth.SessionInfo) (AuthResponse, error) {
+	session, refreshToken, err := auth.CreateSession(user.ID, info)
+	if err != nil {
+		return AuthResponse{}, err
+	}
+	return authResponseForSession(user, session.ID, refreshToken)
+}
+
+func authResponseForSession(user models.User, sessionID, refreshToken string) (AuthResponse, error) {
+	token, err := auth.GenerateToken(user.ID, user.Email, sessionID)
+	if err != nil {
+		return AuthResponse{}, err
+	}
+	return AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresAt:    time.Now().Add(auth.AccessTokenTTL),
+		User:         user,
+	}, nil
+}
+
+// completeLogin finishes a login once the user has proven their first factor.
+// Users with two-factor authentication get a challenge to answer at
+// /api/login/2fa; everyone else gets their tokens straight away.
+func completeLogin(c *gin.Context, user models.User, deviceName string) {
+	methods, err := secondFactorMethods(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load two-factor status"})
+		return
+	}
+	if len(methods) > 0 {
+		challenge, err := auth.IssueUserToken(user.ID, auth.TokenPurposeLoginChallenge, loginChallengeTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor login"})
+			return
+		}
+		c.JSON(http.StatusOK, TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+			Methods:           methods,
+		})
+		return
+	}
+
+	resp, err := newAuthResponse(user, sessionInfo(c, deviceName))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	if err := loginguard.Default().Succeed(user.Email); err != nil {
+		log.Printf("Failed to reset login attempts: %v", err)
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 func Register(c *gin.Context) {
@@ -36,6 +120,10 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	if !validateNewPassword(c, req.Password, req.Email) {
+		return
+	}
+
 	// Check if user exists
 	var existing models.User
 	if result := database.DB.Where("email = ?", req.Email).First(&existing); result.Error == nil {
@@ -63,12 +151,17 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	token, _ := auth.GenerateToken(user.ID, user.Email)
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", user.ID, err)
+	}
 
-	c.JSON(http.StatusCreated, AuthResponse{
-		Token: token,
-		User:  user,
-	})
+	resp, err := newAuthResponse(user, sessionInfo(c, req.DeviceName))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
 }
 
 func Login(c *gin.Context) {
@@ -78,32 +171,118 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// ClientIP only trusts forwarding headers from TRUSTED_PROXIES, so clients
+	// can't dodge the per-IP limit by spoofing X-Forwarded-For
+	guard := loginguard.Default()
+	ip := c.ClientIP()
+	wait, locked, err := guard.Check(req.Email, ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check login attempts"})
+		return
+	}
+	if wait > 0 {
+		rejectLoginAttempt(c, wait, locked)
+		return
+	}
+
+	loginFailed := func() {
+		if err := guard.Fail(req.Email, ip); err != nil {
+			log.Printf("Failed to record failed login: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+	}
+
 	var user models.User
 	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		loginFailed()
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		loginFailed()
 		return
 	}
 
-	token, _ := auth.GenerateToken(user.ID, user.Email)
+	// The failure count is only cleared once the second factor is passed too
+	completeLogin(c, user, req.DeviceName)
+}
 
-	c.JSON(http.StatusOK, AuthResponse{
-		Token: token,
-		User:  user,
+func rejectLoginAttempt(c *gin.Context, wait time.Duration, locked bool) {
+	c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	if locked {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error": "Too many failed login attempts. Try again later.",
+			"code":  "login_locked",
+		})
+		return
+	}
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error": "Please wait before trying again",
+		"code":  "login_throttled",
 	})
 }
 
+// RefreshToken rotates the caller's refresh token and issues a new access token.
+func RefreshToken(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, refreshToken, err := auth.RotateSession(req.RefreshToken, sessionInfo(c, ""))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", session.UserID).First(&user).Error; err != nil {
+		_ = auth.RevokeSession(session.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	resp, err := authResponseForSession(user, session.ID, refreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Logout revokes the session the caller's access token belongs to.
+func Logout(c *gin.Context) {
+	sessionID := c.GetString("sessionID")
+	if sessionID != "" {
+		if err := auth.RevokeSession(sessionID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
 func GetMe(c *gin.Context) {
 	userID := c.GetString("userID")
 	var user models.User
-	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+	if err := database.DB.Preload("Roles").Where("id = ?", userID).First(&user).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
+	perms, err := auth.UserPermissions(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load permissions"})
+		return
+	}
+	user.Permissions = perms
+	user.ImpersonatedBy = c.GetString("impersonatorID")
+
 	c.JSON(http.StatusOK, user)
 }
@@ -1,13 +1,20 @@
 package handlers
 
 import (
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"irontrack-backend/internal/auth"
 	"irontrack-backend/internal/database"
 	"irontrack-backend/internal/models"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -16,13 +23,30 @@ import (
 func GetPlans(c *gin.Context) {
 	userID := c.GetString("userID")
 	var plans []models.WorkoutPlan
-	if err := database.DB.Preload("Exercises").Where("user_id = ?", userID).Find(&plans).Error; err != nil {
+	if err := database.DB.Preload("Exercises", orderPlanExercises).Where("user_id = ?", userID).Find(&plans).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plans"})
 		return
 	}
 	c.JSON(http.StatusOK, plans)
 }
 
+// GetPlan returns one of the caller's plans.
+func GetPlan(c *gin.Context) {
+	var plan models.WorkoutPlan
+	err := database.DB.Preload("Exercises", orderPlanExercises).
+		Where("id = ? AND user_id = ?", c.Param("id"), c.GetString("userID")).
+		First(&plan).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Plan not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch plan"})
+		return
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
 func CreatePlan(c *gin.Context) {
 	userID := c.GetString("userID")
 	var plan models.WorkoutPlan
@@ -36,6 +60,10 @@ func CreatePlan(c *gin.Context) {
 	// We will trust frontend provided ID or generate one if missing logic is added, but Gorm handles insertion.
 	// Ideally we should overwrite ID if we want to ensure uniqueness via backend, but let's assume UUID from FE or simple checks.
 	// Actually, better to just let DB handle it or validate.
+	if err := preparePlanExercises(plan.Exercises); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	if err := database.DB.Create(&plan).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create plan"})
@@ -44,6 +72,303 @@ func CreatePlan(c *gin.Context) {
 	c.JSON(http.StatusCreated, plan)
 }
 
+type PlanExerciseInput struct {
+	// ID refers to an existing exercise of the plan; leave it out to add one.
+	ID           *uint  `json:"id"`
+	Name         string `json:"name"`
+	DefaultSets  int    `json:"defaultSets"`
+	DefaultReps  int    `json:"defaultReps"`
+	MuscleGroup  string `json:"muscleGroup"`
+	Instructions string `json:"instructions"`
+	models.ExerciseGrouping
+	models.ExerciseTargets
+}
+
+// UpdatePlanRequest is the body of PUT and PATCH /plans/:id. With PATCH,
+// fields left out are kept; with PUT they are cleared. Exercises, when given,
+// is the complete new list in order.
+type UpdatePlanRequest struct {
+	Name        *string              `json:"name"`
+	Description *string              `json:"description"`
+	TargetGoal  *string              `json:"targetGoal"`
+	Exercises   *[]PlanExerciseInput `json:"exercises"`
+}
+
+// orderPlanExercises preloads a plan's exercises in their saved order.
+func orderPlanExercises(db *gorm.DB) *gorm.DB {
+	return db.Order("position asc, id asc")
+}
+
+// preparePlanExercises readies exercises for a new plan: IDs are assigned by
+// the database, positions follow the list order and targets and grouping are
+// validated.
+func preparePlanExercises(exercises []models.PlanExercise) error {
+	groups := make([]models.ExerciseGrouping, len(exercises))
+	for i := range exercises {
+		if err := exercises[i].ExerciseTargets.Validate(); err != nil {
+			return fmt.Errorf("exercises[%d]: %w", i, err)
+		}
+		exercises[i].ID = 0
+		exercises[i].Position = i
+		groups[i] = exercises[i].ExerciseGrouping
+	}
+	return models.ValidateGrouping(groups)
+}
+
+// orderLogExercises preloads a log's exercises, or an exercise's sets, in
+// their saved order.
+func orderLogExercises(db *gorm.DB) *gorm.DB {
+	return db.Order("position asc, id asc")
+}
+
+// preloadLogExercises loads a log's exercises in order, with or without sets.
+func preloadLogExercises(query *gorm.DB, withSets bool) *gorm.DB {
+	query = query.Preload("Exercises", orderLogExercises)
+	if withSets {
+		query = query.Preload("Exercises.Sets", orderLogExercises)
+	}
+	return query
+}
+
+// trackingTypes maps lower-cased exercise names to the tracking type of the
+// exercise definition with that name. The user's own definitions win over
+// global ones.
+func trackingTypes(userID string) (map[string]string, error) {
+	var definitions []models.ExerciseDefinition
+	err := database.DB.Select("name", "tracking_type", "is_global").
+		Where("is_global = ? OR user_id = ?", true, userID).
+		Order("is_global desc").
+		Find(&definitions).Error
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string]string, len(definitions))
+	for _, d := range definitions {
+		types[strings.ToLower(strings.TrimSpace(d.Name))] = d.TrackingType
+	}
+	return types, nil
+}
+
+// resolveTrackingType returns the tracking type given for an exercise, or
+// else the one of its definition, or else weight and reps.
+func resolveTrackingType(types map[string]string, name, given string) (string, error) {
+	if given != "" {
+		if !models.ValidTrackingType(given) {
+			return "", fmt.Errorf("trackingType must be weight_reps, bodyweight_reps, duration, distance_duration or weighted_distance")
+		}
+		return given, nil
+	}
+	if t := types[strings.ToLower(strings.TrimSpace(name))]; models.ValidTrackingType(t) {
+		return t, nil
+	}
+	return models.TrackingWeightReps, nil
+}
+
+// prepareLogExercises readies exercises for a new log: missing IDs are
+// generated, exercise and set positions follow the list order, tracking
+// types are resolved and sets, set details and grouping are validated.
+func prepareLogExercises(exercises []models.LogExercise, types map[string]string) error {
+	groups := make([]models.ExerciseGrouping, len(exercises))
+	for i := range exercises {
+		if exercises[i].ID == "" {
+			exercises[i].ID = uuid.New().String()
+		}
+		trackingType, err := resolveTrackingType(types, exercises[i].Name, exercises[i].TrackingType)
+		if err != nil {
+			return fmt.Errorf("exercises[%d]: %w", i, err)
+		}
+		exercises[i].TrackingType = trackingType
+		for j := range exercises[i].Sets {
+			if err := models.ValidateSetFields(trackingType, exercises[i].Sets[j]); err != nil {
+				return fmt.Errorf("exercises[%d].sets[%d]: %w", i, j, err)
+			}
+			if exercises[i].Sets[j].ID == "" {
+				exercises[i].Sets[j].ID = uuid.New().String()
+			}
+			exercises[i].Sets[j].Position = j
+			if err := exercises[i].Sets[j].SetDetails.Validate(); err != nil {
+				return fmt.Errorf("exercises[%d].sets[%d]: %w", i, j, err)
+			}
+		}
+		exercises[i].Position = i
+		groups[i] = exercises[i].ExerciseGrouping
+	}
+	return models.ValidateGrouping(groups)
+}
+
+// ReplacePlan handles PUT /plans/:id.
+func ReplacePlan(c *gin.Context) {
+	updatePlan(c, false)
+}
+
+// PatchPlan handles PATCH /plans/:id.
+func PatchPlan(c *gin.Context) {
+	updatePlan(c, true)
+}
+
+// updatePlan edits a plan in place, keeping its ID and creation time. The
+// exercise list is reconciled against the stored one: entries with an id are
+// edited and moved, entries without one are added, and stored exercises
+// missing from the list are removed, all in one transaction.
+func updatePlan(c *gin.Context, partial bool) {
+	var req UpdatePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !partial {
+		if req.Name == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+			return
+		}
+		empty := ""
+		if req.Description == nil {
+			req.Description = &empty
+		}
+		if req.TargetGoal == nil {
+			req.TargetGoal = &empty
+		}
+		if req.Exercises == nil {
+			req.Exercises = &[]PlanExerciseInput{}
+		}
+	}
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name can't be empty"})
+		return
+	}
+	if req.Exercises != nil {
+		for i, ex := range *req.Exercises {
+			if strings.TrimSpace(ex.Name) == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("exercises[%d].name is required", i)})
+				return
+			}
+			if ex.DefaultSets < 0 || ex.DefaultReps < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("exercises[%d] can't have negative sets or reps", i)})
+				return
+			}
+			if err := ex.ExerciseTargets.Validate(); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("exercises[%d]: %v", i, err)})
+				return
+			}
+		}
+		groups := make([]models.ExerciseGrouping, len(*req.Exercises))
+		for i, ex := range *req.Exercises {
+			groups[i] = ex.ExerciseGrouping
+		}
+		if err := models.ValidateGrouping(groups); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userID := c.GetString("userID")
+	planID := c.Param("id")
+	var plan models.WorkoutPlan
+	if err := database.DB.Where("id = ? AND user_id = ?", planID, userID).First(&plan).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Plan not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load plan"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		fields := map[string]interface{}{}
+		if req.Name != nil {
+			fields["name"] = *req.Name
+		}
+		if req.Description != nil {
+			fields["description"] = *req.Description
+		}
+		if req.TargetGoal != nil {
+			fields["target_goal"] = *req.TargetGoal
+		}
+		if len(fields) > 0 {
+			if err := tx.Model(&models.WorkoutPlan{}).Where("id = ?", plan.ID).Updates(fields).Error; err != nil {
+				return err
+			}
+		}
+		if req.Exercises == nil {
+			return nil
+		}
+		return reconcilePlanExercises(tx, plan.ID, *req.Exercises)
+	})
+	if err != nil {
+		var invalid *invalidPlanExerciseError
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": invalid.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update plan"})
+		return
+	}
+
+	if err := database.DB.Preload("Exercises", orderPlanExercises).Where("id = ?", plan.ID).First(&plan).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load plan"})
+		return
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
+type invalidPlanExerciseError struct {
+	id uint
+}
+
+func (e *invalidPlanExerciseError) Error() string {
+	return fmt.Sprintf("Exercise %d is not part of this plan or is listed twice", e.id)
+}
+
+func reconcilePlanExercises(tx *gorm.DB, planID string, inputs []PlanExerciseInput) error {
+	var existing []models.PlanExercise
+	if err := tx.Where("plan_id = ?", planID).Find(&existing).Error; err != nil {
+		return err
+	}
+	remaining := make(map[uint]bool, len(existing))
+	for _, ex := range existing {
+		remaining[ex.ID] = true
+	}
+
+	for i, in := range inputs {
+		row := models.PlanExercise{
+			PlanID:           planID,
+			Position:         i,
+			Name:             in.Name,
+			DefaultSets:      in.DefaultSets,
+			DefaultReps:      in.DefaultReps,
+			MuscleGroup:      in.MuscleGroup,
+			Instructions:     in.Instructions,
+			ExerciseGrouping: in.ExerciseGrouping,
+			ExerciseTargets:  in.ExerciseTargets,
+		}
+		if in.ID == nil {
+			if err := tx.Create(&row).Error; err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !remaining[*in.ID] {
+			return &invalidPlanExerciseError{id: *in.ID}
+		}
+		delete(remaining, *in.ID)
+		row.ID = *in.ID
+		if err := tx.Save(&row).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(remaining) == 0 {
+		return nil
+	}
+	removed := make([]uint, 0, len(remaining))
+	for id := range remaining {
+		removed = append(removed, id)
+	}
+	return tx.Where("plan_id = ? AND id IN ?", planID, removed).Delete(&models.PlanExercise{}).Error
+}
+
 func DeletePlan(c *gin.Context) {
 	userID := c.GetString("userID")
 	planID := c.Param("id")
@@ -57,17 +382,165 @@ func DeletePlan(c *gin.Context) {
 
 // --- Logs ---
 
+const maxLogsPageSize = 200
+
+// GetLogs returns the caller's workout history, newest first.
+//
+// Query parameters (all optional):
+//   - limit: page size, up to maxLogsPageSize. Without limit or cursor the
+//     whole history is returned, as older clients expect.
+//   - cursor: the X-Next-Cursor value from the previous page.
+//   - from, to: date range, as RFC 3339 or YYYY-MM-DD (to is inclusive).
+//   - planName, exercise: case-insensitive substring matches.
+//   - view=summary: leave out sets.
+//   - status: completed (the default), draft or in_progress.
+//
+// When more logs follow, the X-Next-Cursor response header is set.
 func GetLogs(c *gin.Context) {
 	userID := c.GetString("userID")
+	status := c.DefaultQuery("status", models.LogStatusCompleted)
+	switch status {
+	case models.LogStatusCompleted, models.LogStatusDraft, models.LogStatusInProgress:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be completed, draft or in_progress"})
+		return
+	}
+	query := database.DB.Where("user_id = ? AND status = ?", userID, status)
+
+	from, ok := parseDateParam(c, "from", false)
+	if !ok {
+		return
+	}
+	if from != nil {
+		query = query.Where("date >= ?", *from)
+	}
+	to, ok := parseDateParam(c, "to", true)
+	if !ok {
+		return
+	}
+	if to != nil {
+		query = query.Where("date < ?", *to)
+	}
+	if planName := strings.TrimSpace(c.Query("planName")); planName != "" {
+		query = query.Where("LOWER(plan_name) LIKE ? ESCAPE '\\'", likePattern(planName))
+	}
+	if exercise := strings.TrimSpace(c.Query("exercise")); exercise != "" {
+		query = query.Where("id IN (?)", database.DB.Model(&models.LogExercise{}).
+			Select("log_id").Where("LOWER(name) LIKE ? ESCAPE '\\'", likePattern(exercise)))
+	}
+
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		limit = min(n, maxLogsPageSize)
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		date, id, err := decodeLogCursor(cursor)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		query = query.Where("date < ? OR (date = ? AND id < ?)", date, date, id)
+		if limit == 0 {
+			limit = maxLogsPageSize
+		}
+	}
+	if limit > 0 {
+		// One extra row tells us whether there is a next page
+		query = query.Limit(limit + 1)
+	}
+
+	query = preloadLogExercises(query, c.Query("view") != "summary")
+
 	var logs []models.WorkoutLog
-	// Preload nested structure
-	if err := database.DB.Preload("Exercises.Sets").Where("user_id = ?", userID).Order("date desc").Find(&logs).Error; err != nil {
+	if err := query.Order("date desc, id desc").Find(&logs).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch logs"})
 		return
 	}
+
+	if limit > 0 && len(logs) > limit {
+		logs = logs[:limit]
+		last := logs[len(logs)-1]
+		c.Header("X-Next-Cursor", encodeLogCursor(last.Date, last.ID))
+	}
 	c.JSON(http.StatusOK, logs)
 }
 
+// parseDateParam reads an RFC 3339 timestamp or a YYYY-MM-DD date from the
+// query. With endOfDay, a plain date means the end of that day, so it can be
+// used as an exclusive upper bound.
+func parseDateParam(c *gin.Context, name string, endOfDay bool) (*time.Time, bool) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, true
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		if endOfDay {
+			// An explicit timestamp is inclusive too
+			t = t.Add(time.Nanosecond)
+		}
+		return &t, true
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a date (YYYY-MM-DD) or RFC 3339 timestamp"})
+		return nil, false
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, true
+}
+
+func likePattern(s string) string {
+	s = strings.ToLower(s)
+	s = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+	return "%" + s + "%"
+}
+
+// Log cursors are opaque to clients: base64 of "<date>|<id>" of the last log
+// on the page.
+func encodeLogCursor(date time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(date.UTC().Format(time.RFC3339Nano) + "|" + id))
+}
+
+func decodeLogCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	date, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return time.Time{}, "", errors.New("malformed cursor")
+	}
+	t, err := time.Parse(time.RFC3339Nano, date)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	return t, id, nil
+}
+
+// GetLog returns one of the caller's workout logs.
+func GetLog(c *gin.Context) {
+	var log models.WorkoutLog
+	err := preloadLogExercises(database.DB, true).
+		Where("id = ? AND user_id = ?", c.Param("id"), c.GetString("userID")).
+		First(&log).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Log not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch log"})
+		return
+	}
+	c.JSON(http.StatusOK, log)
+}
+
 func CreateLog(c *gin.Context) {
 	userID := c.GetString("userID")
 	var log models.WorkoutLog
@@ -76,14 +549,413 @@ func CreateLog(c *gin.Context) {
 		return
 	}
 	log.UserID = userID
+	switch log.Status {
+	case "":
+		log.Status = models.LogStatusCompleted
+	case models.LogStatusDraft, models.LogStatusCompleted:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be draft or completed"})
+		return
+	}
+	types, err := trackingTypes(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load exercises"})
+		return
+	}
+	if err := prepareLogExercises(log.Exercises, types); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	if err := database.DB.Create(&log).Error; err != nil {
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkNewLogRows(tx, log.Exercises); err != nil {
+			return err
+		}
+		return tx.Create(&log).Error
+	})
+	if err != nil {
+		var invalid *invalidLogRowError
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": invalid.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create log"})
 		return
 	}
 	c.JSON(http.StatusCreated, log)
 }
 
+// checkNewLogRows makes sure client-supplied exercise and set IDs are new.
+// Saving the log upserts its exercises and sets by ID, which would otherwise
+// move an existing row, possibly someone else's, into it.
+func checkNewLogRows(tx *gorm.DB, exercises []models.LogExercise) error {
+	seen := map[string]bool{}
+	check := func(kind, id string, model interface{}) error {
+		if seen[kind+id] {
+			return &invalidLogRowError{kind: kind, id: id}
+		}
+		seen[kind+id] = true
+		taken, err := rowExists(tx, model, id)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return &invalidLogRowError{kind: kind, id: id}
+		}
+		return nil
+	}
+	for _, ex := range exercises {
+		if err := check("Exercise", ex.ID, &models.LogExercise{}); err != nil {
+			return err
+		}
+		for _, set := range ex.Sets {
+			if err := check("Set", set.ID, &models.LogSet{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type LogSetInput struct {
+	// ID of an existing set of this exercise; leave it out to add one.
+	ID        string  `json:"id"`
+	Weight    float64 `json:"weight"`
+	Reps      int     `json:"reps"`
+	Completed bool    `json:"completed"`
+	// DurationSeconds and DistanceMeters are for timed and distance exercises
+	DurationSeconds int     `json:"durationSeconds"`
+	DistanceMeters  float64 `json:"distanceMeters"`
+	models.SetDetails
+}
+
+type LogExerciseInput struct {
+	// ID of an existing exercise of this log; leave it out to add one.
+	ID           string        `json:"id"`
+	Name         string        `json:"name"`
+	MuscleGroup  string        `json:"muscleGroup"`
+	Instructions string        `json:"instructions"`
+	TrackingType string        `json:"trackingType"`
+	Sets         []LogSetInput `json:"sets"`
+	models.ExerciseGrouping
+}
+
+// UpdateLogRequest is the body of PUT and PATCH /logs/:id. With PATCH, fields
+// left out are kept; with PUT they are cleared. Exercises, when given, is the
+// complete new list, each with its complete list of sets.
+type UpdateLogRequest struct {
+	Date            *time.Time          `json:"date"`
+	DurationMinutes *int                `json:"durationMinutes"`
+	PlanName        *string             `json:"planName"`
+	Exercises       *[]LogExerciseInput `json:"exercises"`
+	// Status can only move a draft to completed; it is kept when left out.
+	Status *string `json:"status"`
+}
+
+// ReplaceLog handles PUT /logs/:id.
+func ReplaceLog(c *gin.Context) {
+	updateLog(c, false)
+}
+
+// PatchLog handles PATCH /logs/:id.
+func PatchLog(c *gin.Context) {
+	updateLog(c, true)
+}
+
+// updateLog corrects a recorded workout. Exercises and sets are reconciled
+// like plan exercises: rows with a known id are edited, rows without one are
+// added and stored rows missing from the request are removed, all in one
+// transaction.
+func updateLog(c *gin.Context, partial bool) {
+	var req UpdateLogRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !partial {
+		if req.Date == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date is required"})
+			return
+		}
+		zero, empty := 0, ""
+		if req.DurationMinutes == nil {
+			req.DurationMinutes = &zero
+		}
+		if req.PlanName == nil {
+			req.PlanName = &empty
+		}
+		if req.Exercises == nil {
+			req.Exercises = &[]LogExerciseInput{}
+		}
+	}
+	if req.Status != nil && *req.Status != models.LogStatusCompleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status can only be set to completed"})
+		return
+	}
+	if req.DurationMinutes != nil && *req.DurationMinutes < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "durationMinutes can't be negative"})
+		return
+	}
+	if req.Exercises != nil {
+		types, err := trackingTypes(c.GetString("userID"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load exercises"})
+			return
+		}
+		for i := range *req.Exercises {
+			ex := &(*req.Exercises)[i]
+			if strings.TrimSpace(ex.Name) == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("exercises[%d].name is required", i)})
+				return
+			}
+			if ex.TrackingType, err = resolveTrackingType(types, ex.Name, ex.TrackingType); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("exercises[%d]: %v", i, err)})
+				return
+			}
+			for j := range ex.Sets {
+				set := &ex.Sets[j]
+				fields := models.LogSet{
+					Weight:          set.Weight,
+					Reps:            set.Reps,
+					Completed:       set.Completed,
+					DurationSeconds: set.DurationSeconds,
+					DistanceMeters:  set.DistanceMeters,
+				}
+				if err := models.ValidateSetFields(ex.TrackingType, fields); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("exercises[%d].sets[%d]: %v", i, j, err)})
+					return
+				}
+				if err := set.SetDetails.Validate(); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("exercises[%d].sets[%d]: %v", i, j, err)})
+					return
+				}
+			}
+		}
+		groups := make([]models.ExerciseGrouping, len(*req.Exercises))
+		for i, ex := range *req.Exercises {
+			groups[i] = ex.ExerciseGrouping
+		}
+		if err := models.ValidateGrouping(groups); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userID := c.GetString("userID")
+	var log models.WorkoutLog
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&log).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Log not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load log"})
+		return
+	}
+	if req.Status != nil && log.Status == models.LogStatusInProgress {
+		c.JSON(http.StatusConflict, gin.H{"error": "Finish the workout in progress with POST /workouts/current/finish"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		fields := map[string]interface{}{}
+		if req.Date != nil {
+			fields["date"] = *req.Date
+		}
+		if req.DurationMinutes != nil {
+			fields["duration_minutes"] = *req.DurationMinutes
+		}
+		if req.PlanName != nil {
+			fields["plan_name"] = *req.PlanName
+		}
+		if req.Status != nil {
+			fields["status"] = *req.Status
+		}
+		if len(fields) > 0 {
+			if err := tx.Model(&models.WorkoutLog{}).Where("id = ?", log.ID).Updates(fields).Error; err != nil {
+				return err
+			}
+		}
+		if req.Exercises == nil {
+			return nil
+		}
+		return reconcileLogExercises(tx, log.ID, *req.Exercises)
+	})
+	if err != nil {
+		var invalid *invalidLogRowError
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": invalid.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update log"})
+		return
+	}
+
+	if err := preloadLogExercises(database.DB, true).Where("id = ?", log.ID).First(&log).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load log"})
+		return
+	}
+	c.JSON(http.StatusOK, log)
+}
+
+type invalidLogRowError struct {
+	kind, id string
+}
+
+func (e *invalidLogRowError) Error() string {
+	return fmt.Sprintf("%s %q belongs to another log or is listed twice", e.kind, e.id)
+}
+
+func reconcileLogExercises(tx *gorm.DB, logID string, inputs []LogExerciseInput) error {
+	var existing []models.LogExercise
+	if err := tx.Where("log_id = ?", logID).Find(&existing).Error; err != nil {
+		return err
+	}
+	remaining := make(map[string]bool, len(existing))
+	for _, ex := range existing {
+		remaining[ex.ID] = true
+	}
+
+	for i, in := range inputs {
+		row := models.LogExercise{
+			ID:               in.ID,
+			LogID:            logID,
+			Position:         i,
+			Name:             in.Name,
+			MuscleGroup:      in.MuscleGroup,
+			Instructions:     in.Instructions,
+			TrackingType:     in.TrackingType,
+			ExerciseGrouping: in.ExerciseGrouping,
+		}
+		if remaining[in.ID] {
+			delete(remaining, in.ID)
+			if err := tx.Save(&row).Error; err != nil {
+				return err
+			}
+		} else {
+			if in.ID == "" {
+				row.ID = uuid.New().String()
+			} else if taken, err := rowExists(tx, &models.LogExercise{}, in.ID); err != nil {
+				return err
+			} else if taken {
+				return &invalidLogRowError{kind: "Exercise", id: in.ID}
+			}
+			if err := tx.Create(&row).Error; err != nil {
+				return err
+			}
+		}
+		if err := reconcileLogSets(tx, row.ID, in.Sets); err != nil {
+			return err
+		}
+	}
+
+	if len(remaining) == 0 {
+		return nil
+	}
+	removed := make([]string, 0, len(remaining))
+	for id := range remaining {
+		removed = append(removed, id)
+	}
+	if err := tx.Where("log_exercise_id IN ?", removed).Delete(&models.LogSet{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("log_id = ? AND id IN ?", logID, removed).Delete(&models.LogExercise{}).Error
+}
+
+func reconcileLogSets(tx *gorm.DB, logExerciseID string, inputs []LogSetInput) error {
+	var existing []models.LogSet
+	if err := tx.Where("log_exercise_id = ?", logExerciseID).Find(&existing).Error; err != nil {
+		return err
+	}
+	remaining := make(map[string]bool, len(existing))
+	for _, set := range existing {
+		remaining[set.ID] = true
+	}
+
+	for i, in := range inputs {
+		row := models.LogSet{
+			ID:              in.ID,
+			LogExerciseID:   logExerciseID,
+			Position:        i,
+			Weight:          in.Weight,
+			Reps:            in.Reps,
+			Completed:       in.Completed,
+			DurationSeconds: in.DurationSeconds,
+			DistanceMeters:  in.DistanceMeters,
+			SetDetails:      in.SetDetails,
+		}
+		if remaining[in.ID] {
+			delete(remaining, in.ID)
+			if err := tx.Save(&row).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if in.ID == "" {
+			row.ID = uuid.New().String()
+		} else if taken, err := rowExists(tx, &models.LogSet{}, in.ID); err != nil {
+			return err
+		} else if taken {
+			return &invalidLogRowError{kind: "Set", id: in.ID}
+		}
+		if err := tx.Create(&row).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(remaining) == 0 {
+		return nil
+	}
+	removed := make([]string, 0, len(remaining))
+	for id := range remaining {
+		removed = append(removed, id)
+	}
+	return tx.Where("log_exercise_id = ? AND id IN ?", logExerciseID, removed).Delete(&models.LogSet{}).Error
+}
+
+// rowExists reports whether a row of the model's table has the given ID.
+func rowExists(tx *gorm.DB, model interface{}, id string) (bool, error) {
+	var count int64
+	err := tx.Model(model).Where("id = ?", id).Count(&count).Error
+	return count > 0, err
+}
+
+// DeleteLog removes one of the caller's logs with its exercises and sets.
+func DeleteLog(c *gin.Context) {
+	userID := c.GetString("userID")
+	logID := c.Param("id")
+
+	var log models.WorkoutLog
+	if err := database.DB.Where("id = ? AND user_id = ?", logID, userID).First(&log).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Log not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load log"})
+		return
+	}
+
+	if err := deleteLog(log.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete log"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Log deleted"})
+}
+
+// deleteLog removes a log with its exercises and sets in one transaction.
+func deleteLog(logID string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		exerciseIDs := tx.Model(&models.LogExercise{}).Select("id").Where("log_id = ?", logID)
+		if err := tx.Where("log_exercise_id IN (?)", exerciseIDs).Delete(&models.LogSet{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("log_id = ?", logID).Delete(&models.LogExercise{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", logID).Delete(&models.WorkoutLog{}).Error
+	})
+}
+
 // --- Exercises ---
 
 func GetExercises(c *gin.Context) {
@@ -108,6 +980,9 @@ func CreateExercise(c *gin.Context) {
 
 	exercise.UserID = &userID
 	exercise.IsGlobal = false // User exercises are never global
+	if !normalizeTrackingType(c, &exercise) {
+		return
+	}
 
 	if err := database.DB.Create(&exercise).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create exercise"})
@@ -116,6 +991,19 @@ func CreateExercise(c *gin.Context) {
 	c.JSON(http.StatusCreated, exercise)
 }
 
+// normalizeTrackingType defaults an exercise definition to weight and reps,
+// answering 400 if it names an unknown tracking type.
+func normalizeTrackingType(c *gin.Context, exercise *models.ExerciseDefinition) bool {
+	if exercise.TrackingType == "" {
+		exercise.TrackingType = models.TrackingWeightReps
+	}
+	if !models.ValidTrackingType(exercise.TrackingType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: trackingType must be weight_reps, bodyweight_reps, duration, distance_duration or weighted_distance", exercise.Name)})
+		return false
+	}
+	return true
+}
+
 func DeleteExercise(c *gin.Context) {
 	userID := c.GetString("userID")
 	exerciseID := c.Param("id")
@@ -130,19 +1018,23 @@ func DeleteExercise(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := database.DB.Select("is_admin").Where("id = ?", userID).First(&user).Error; err != nil {
+	canManage, err := auth.HasPermission(userID, models.PermExercisesManage)
+	if err == nil && canManage {
+		// Same bar as the admin routes
+		canManage, err = auth.TwoFactorSatisfied(c, userID)
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify user permissions"})
 		return
 	}
 
-	// Non-admins can only delete their own exercises, admins can delete any (including global)
+	// Users can only delete their own exercises, exercise managers can delete any (including global)
 	if exercise.UserID == nil {
-		if !user.IsAdmin {
+		if !canManage {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can delete global exercises"})
 			return
 		}
-	} else if *exercise.UserID != userID && !user.IsAdmin {
+	} else if *exercise.UserID != userID && !canManage {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to delete this exercise"})
 		return
 	}
@@ -171,6 +1063,9 @@ func BulkUploadExercises(c *gin.Context) {
 	for i := range exercises {
 		exercises[i].IsGlobal = true
 		exercises[i].UserID = nil
+		if !normalizeTrackingType(c, &exercises[i]) {
+			return
+		}
 	}
 
 	// Bulk insert exercises
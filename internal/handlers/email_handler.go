@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"irontrack-backend/internal/auth"
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	emailVerificationTTL = 48 * time.Hour
+	// A user may ask for a new verification email once a minute, and a few times a day.
+	verificationResendCooldown   = time.Minute
+	verificationResendDailyLimit = 5
+)
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// sendVerificationEmail issues a fresh verification token and mails it to the user.
+func sendVerificationEmail(user models.User) error {
+	token, err := auth.IssueUserToken(user.ID, auth.TokenPurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	sendMail(user.Email, "Confirm your IronTrack email", fmt.Sprintf(
+		"Hi %s,\n\nWelcome to IronTrack! Please confirm your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in 48 hours.",
+		user.Name, appLink("/verify-email", token)))
+	return nil
+}
+
+// VerifyEmail confirms the address a verification token was sent to.
+func VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := auth.ConsumeUserToken(req.Token, auth.TokenPurposeEmailVerification)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		return
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(&models.User{}).Where("id = ?", token.UserID).Updates(map[string]interface{}{
+		"email_verified":    true,
+		"email_verified_at": now,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// ResendVerificationEmail sends the caller a new verification link, subject to throttling.
+func ResendVerificationEmail(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.EmailVerified {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is already verified"})
+		return
+	}
+
+	var recent []models.UserToken
+	if err := database.DB.
+		Where("user_id = ? AND purpose = ? AND created_at > ?", userID, auth.TokenPurposeEmailVerification, time.Now().Add(-24*time.Hour)).
+		Order("created_at desc").
+		Find(&recent).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check verification history"})
+		return
+	}
+
+	if len(recent) > 0 {
+		if wait := verificationResendCooldown - time.Since(recent[0].CreatedAt); wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Please wait before requesting another verification email"})
+			return
+		}
+	}
+	if len(recent) >= verificationResendDailyLimit {
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(recent[len(recent)-1].CreatedAt.Add(24*time.Hour)).Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many verification emails requested today"})
+		return
+	}
+
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("Failed to issue verification token for %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"irontrack-backend/internal/auth"
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ImpersonateRequest struct {
+	// Reason is kept in the audit log, e.g. a support ticket reference.
+	Reason string `json:"reason" binding:"required"`
+}
+
+type ImpersonationResponse struct {
+	Token         string               `json:"token"`
+	ExpiresAt     time.Time            `json:"expiresAt"`
+	Impersonation models.Impersonation `json:"impersonation"`
+}
+
+// AdminStartImpersonation issues a short-lived, read-only token that lets
+// support see the API exactly as the user does.
+func AdminStartImpersonation(c *gin.Context) {
+	var req ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adminID := c.GetString("userID")
+	var target models.User
+	if err := database.DB.Where("id = ?", c.Param("id")).First(&target).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if target.ID == adminID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't impersonate yourself"})
+		return
+	}
+
+	// Staff accounts are off limits, so impersonation can't be used to borrow
+	// someone else's permissions
+	perms, err := auth.UserPermissions(target.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load permissions"})
+		return
+	}
+	if len(perms) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Staff accounts can't be impersonated"})
+		return
+	}
+
+	impersonation, token, err := auth.StartImpersonation(adminID, &target, req.Reason, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start impersonation"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, ImpersonationResponse{
+		Token:         token,
+		ExpiresAt:     impersonation.ExpiresAt,
+		Impersonation: *impersonation,
+	})
+}
+
+// AdminListImpersonations lists impersonations, newest first. Filter with
+// ?userId= or ?adminId=.
+func AdminListImpersonations(c *gin.Context) {
+	query := database.DB.Order("created_at desc").Limit(200)
+	if userID := c.Query("userId"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if adminID := c.Query("adminId"); adminID != "" {
+		query = query.Where("admin_id = ?", adminID)
+	}
+
+	var impersonations []models.Impersonation
+	if err := query.Find(&impersonations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load impersonations"})
+		return
+	}
+	c.JSON(http.StatusOK, impersonations)
+}
+
+// AdminGetImpersonation returns one impersonation with every request made during it.
+func AdminGetImpersonation(c *gin.Context) {
+	var impersonation models.Impersonation
+	err := database.DB.
+		Preload("Requests", func(db *gorm.DB) *gorm.DB { return db.Order("created_at asc") }).
+		Where("id = ?", c.Param("id")).
+		First(&impersonation).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Impersonation not found"})
+		return
+	}
+	c.JSON(http.StatusOK, impersonation)
+}
+
+// AdminEndImpersonation revokes an impersonation token before it expires.
+func AdminEndImpersonation(c *gin.Context) {
+	var impersonation models.Impersonation
+	if err := database.DB.Where("id = ?", c.Param("id")).First(&impersonation).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Impersonation not found"})
+		return
+	}
+
+	ended, err := auth.EndImpersonation(&impersonation)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end impersonation"})
+		return
+	}
+	if !ended {
+		c.JSON(http.StatusOK, gin.H{"message": "Impersonation already ended"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Impersonation ended"})
+}
@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"net/http"
+
+	"irontrack-backend/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKS publishes the public keys our access tokens can be verified with.
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, auth.PublicJWKS())
+}
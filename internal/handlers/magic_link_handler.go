@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"irontrack-backend/internal/auth"
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/loginguard"
+	"irontrack-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	magicLinkTTL = 15 * time.Minute
+	// Requests beyond these limits are silently dropped so the endpoint can't
+	// be used to flood someone's inbox.
+	magicLinkCooldown   = time.Minute
+	magicLinkDailyLimit = 10
+)
+
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type MagicLinkLoginRequest struct {
+	Token      string `json:"token" binding:"required"`
+	DeviceName string `json:"deviceName"`
+}
+
+// RequestMagicLink emails a one-time sign-in link if the account exists. Like
+// ForgotPassword, the response doesn't reveal whether it does.
+func RequestMagicLink(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := gin.H{"message": "If an account exists for that email, a sign-in link has been sent"}
+
+	var user models.User
+	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	var recent []models.UserToken
+	if err := database.DB.
+		Where("user_id = ? AND purpose = ? AND created_at > ?", user.ID, auth.TokenPurposeMagicLink, time.Now().Add(-24*time.Hour)).
+		Order("created_at desc").
+		Find(&recent).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send sign-in link"})
+		return
+	}
+	if len(recent) >= magicLinkDailyLimit || (len(recent) > 0 && time.Since(recent[0].CreatedAt) < magicLinkCooldown) {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	token, err := auth.IssueUserToken(user.ID, auth.TokenPurposeMagicLink, magicLinkTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send sign-in link"})
+		return
+	}
+
+	sendMail(user.Email, "Your IronTrack sign-in link", fmt.Sprintf(
+		"Hi %s,\n\nOpen the link below within 15 minutes to sign in to IronTrack:\n\n%s\n\n"+
+			"The link works once. If you didn't ask for it, you can ignore this email.",
+		user.Name, appLink("/magic-link", token)))
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// MagicLinkLogin exchanges a sign-in link token for a session. The response
+// is the same as Login, including the two-factor challenge when enabled.
+func MagicLinkLogin(c *gin.Context) {
+	var req MagicLinkLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := auth.ConsumeUserToken(req.Token, auth.TokenPurposeMagicLink)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired sign-in link"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", token.UserID).First(&user).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired sign-in link"})
+		return
+	}
+
+	// Opening the link proves the user controls the mailbox
+	if !user.EmailVerified {
+		now := time.Now()
+		if err := database.DB.Model(&user).Updates(map[string]interface{}{
+			"email_verified":    true,
+			"email_verified_at": now,
+		}).Error; err != nil {
+			log.Printf("Failed to mark email verified for %s: %v", user.ID, err)
+		}
+	}
+	if err := loginguard.Default().Succeed(user.Email); err != nil {
+		log.Printf("Failed to reset login attempts: %v", err)
+	}
+
+	completeLogin(c, user, req.DeviceName)
+}
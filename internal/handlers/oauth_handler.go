@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"irontrack-backend/internal/auth"
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// How long the user has to finish signing in at the provider.
+const oauthStateTTL = 10 * time.Minute
+
+var (
+	errLinkedUserMissing = errors.New("linked user not found")
+	errNoEmail           = errors.New("provider did not share an email address")
+	errEmailTaken        = errors.New("email belongs to an account that can't be linked automatically")
+)
+
+type OIDCCallbackRequest struct {
+	Code       string `json:"code" binding:"required"`
+	State      string `json:"state" binding:"required"`
+	DeviceName string `json:"deviceName"`
+}
+
+func oidcProvider(c *gin.Context) (*auth.OIDCProvider, bool) {
+	provider, err := auth.OIDCProviderFromEnv(c.Param("provider"))
+	if err != nil {
+		if errors.Is(err, auth.ErrUnknownOIDCProvider) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+		} else {
+			log.Printf("OIDC provider misconfigured: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Login provider is not configured"})
+		}
+		return nil, false
+	}
+	return provider, true
+}
+
+// StartOIDCLogin begins a social login. It returns the provider URL to open,
+// or redirects straight to it when called with ?redirect=true.
+func StartOIDCLogin(c *gin.Context) {
+	provider, ok := oidcProvider(c)
+	if !ok {
+		return
+	}
+
+	state, err1 := auth.NewOIDCState()
+	nonce, err2 := auth.NewOIDCState()
+	verifier, err3 := auth.NewPKCEVerifier()
+	if err := errors.Join(err1, err2, err3); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	authURL, err := provider.AuthorizationURL(ctx, state, nonce, verifier)
+	if err != nil {
+		log.Printf("OIDC discovery for %s failed: %v", provider.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Login provider is unavailable"})
+		return
+	}
+
+	now := time.Now()
+	// Clear out logins that were abandoned at the provider
+	database.DB.Where("expires_at < ?", now).Delete(&models.OAuthState{})
+
+	if err := database.DB.Create(&models.OAuthState{
+		State:        state,
+		Provider:     provider.Name,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    now.Add(oauthStateTTL),
+		CreatedAt:    now,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	if c.Query("redirect") == "true" {
+		c.Redirect(http.StatusFound, authURL)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"authorizationUrl": authURL, "state": state})
+}
+
+// OIDCCallback finishes a social login: it redeems the authorization code,
+// links the provider account to a user (creating one if needed) and logs them in.
+func OIDCCallback(c *gin.Context) {
+	provider, ok := oidcProvider(c)
+	if !ok {
+		return
+	}
+
+	var req OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var state models.OAuthState
+	if err := database.DB.Where("state = ? AND provider = ?", req.State, provider.Name).First(&state).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+		return
+	}
+	// States are single-use
+	result := database.DB.Where("state = ?", state.State).Delete(&models.OAuthState{})
+	if result.Error != nil || result.RowsAffected == 0 || time.Now().After(state.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 15*time.Second)
+	defer cancel()
+
+	identity, err := provider.Exchange(ctx, req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("OIDC login with %s failed: %v", provider.Name, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login with provider failed"})
+		return
+	}
+
+	user, err := userForIdentity(provider.Name, identity)
+	switch {
+	case errors.Is(err, errLinkedUserMissing):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	case errors.Is(err, errNoEmail):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The provider did not share an email address"})
+		return
+	case errors.Is(err, errEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists. Log in with your password first."})
+		return
+	case err != nil:
+		log.Printf("OIDC login with %s failed: %v", provider.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login with provider failed"})
+		return
+	}
+
+	completeLogin(c, user, req.DeviceName)
+}
+
+// userForIdentity finds the user linked to a provider account. Unlinked
+// accounts are matched to an existing user whose email is verified on both
+// sides, or a new user is created.
+func userForIdentity(provider string, identity *auth.OIDCIdentity) (models.User, error) {
+	var user models.User
+
+	var link models.UserIdentity
+	err := database.DB.Where("provider = ? AND subject = ?", provider, identity.Subject).First(&link).Error
+	if err == nil {
+		if err := database.DB.Where("id = ?", link.UserID).First(&user).Error; err != nil {
+			return user, errLinkedUserMissing
+		}
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, fmt.Errorf("look up linked account: %w", err)
+	}
+
+	if identity.Email == "" {
+		return user, errNoEmail
+	}
+
+	err = database.DB.Where("email = ?", identity.Email).First(&user).Error
+	switch {
+	case err == nil:
+		// Only link to an existing account when both the provider and we have
+		// confirmed the email. Otherwise anyone could claim someone else's
+		// account, or sign up with a victim's address ahead of them and keep a
+		// password once the victim links their provider account.
+		if !identity.EmailVerified || !user.EmailVerified {
+			return user, errEmailTaken
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		now := time.Now()
+		user = models.User{
+			ID:            uuid.New().String(),
+			Email:         identity.Email,
+			Name:          identity.Name,
+			EmailVerified: identity.EmailVerified,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if identity.EmailVerified {
+			user.EmailVerifiedAt = &now
+		}
+		if err := database.DB.Create(&user).Error; err != nil {
+			return user, fmt.Errorf("create user: %w", err)
+		}
+	default:
+		return user, fmt.Errorf("look up user: %w", err)
+	}
+
+	if err := database.DB.Create(&models.UserIdentity{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		Provider:  provider,
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+		CreatedAt: time.Now(),
+	}).Error; err != nil {
+		return user, fmt.Errorf("link account: %w", err)
+	}
+	return user, nil
+}
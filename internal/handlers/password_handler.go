@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"irontrack-backend/internal/auth"
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/loginguard"
+	"irontrack-backend/internal/mail"
+	"irontrack-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	passwordResetTTL = time.Hour
+	// Requests beyond these limits are silently dropped so the endpoint can't
+	// be used to flood someone's inbox.
+	passwordResetCooldown   = time.Minute
+	passwordResetDailyLimit = 5
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required"`
+}
+
+// validateNewPassword applies auth.PasswordPolicy and answers 400 if the
+// password doesn't meet it.
+func validateNewPassword(c *gin.Context, password, email string) bool {
+	if err := auth.ValidatePassword(password, email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "weak_password"})
+		return false
+	}
+	return true
+}
+
+// appLink builds a link into the client app, e.g. /reset-password?token=...
+func appLink(path, token string) string {
+	base := os.Getenv("APP_BASE_URL")
+	if base == "" {
+		base = "http://localhost:5173"
+	}
+	return strings.TrimRight(base, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendMail delivers an email without failing the request; delivery problems are logged.
+func sendMail(to, subject, body string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := mail.Send(ctx, mail.Message{To: to, Subject: subject, Body: body}); err != nil {
+		log.Printf("Failed to send %q email to %s: %v", subject, to, err)
+	}
+}
+
+// ForgotPassword emails a reset link if the account exists. The response is the
+// same either way so the endpoint can't be used to probe for registered emails.
+func ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Done after responding, so how long the request takes doesn't give the
+	// answer away either
+	go sendPasswordReset(req.Email)
+
+	c.JSON(http.StatusOK, gin.H{"message": "If an account exists for that email, a reset link has been sent"})
+}
+
+// sendPasswordReset mails a reset link to the account with the email, if there
+// is one and it hasn't asked for too many lately.
+func sendPasswordReset(email string) {
+	var user models.User
+	if err := database.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Failed to look up account for password reset: %v", err)
+		}
+		return
+	}
+
+	var recent []models.UserToken
+	if err := database.DB.
+		Where("user_id = ? AND purpose = ? AND created_at > ?", user.ID, auth.TokenPurposePasswordReset, time.Now().Add(-24*time.Hour)).
+		Order("created_at desc").
+		Find(&recent).Error; err != nil {
+		log.Printf("Failed to check password reset history for %s: %v", user.ID, err)
+		return
+	}
+	if len(recent) >= passwordResetDailyLimit || (len(recent) > 0 && time.Since(recent[0].CreatedAt) < passwordResetCooldown) {
+		return
+	}
+
+	token, err := auth.IssueUserToken(user.ID, auth.TokenPurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		log.Printf("Failed to create reset token for %s: %v", user.ID, err)
+		return
+	}
+
+	sendMail(user.Email, "Reset your IronTrack password", fmt.Sprintf(
+		"Hi %s,\n\nSomeone asked to reset the password for your IronTrack account. "+
+			"Open the link below within the next hour to choose a new one:\n\n%s\n\n"+
+			"If this wasn't you, you can ignore this email.",
+		user.Name, appLink("/reset-password", token)))
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword and logs
+// the user out everywhere.
+func ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check the new password before burning the token, so the user can retry
+	pending, err := auth.LookupUserToken(req.Token, auth.TokenPurposePasswordReset)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	var owner models.User
+	if err := database.DB.Select("email").Where("id = ?", pending.UserID).First(&owner).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if !validateNewPassword(c, req.Password, owner.Email) {
+		return
+	}
+
+	token, err := auth.ConsumeUserToken(req.Token, auth.TokenPurposePasswordReset)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	result := database.DB.Model(&models.User{}).Where("id = ?", token.UserID).Updates(map[string]interface{}{
+		"password":   string(hashedPassword),
+		"updated_at": time.Now(),
+	})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+
+	if _, err := auth.RevokeOtherSessions(token.UserID, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	if err := auth.RevokeAllPersonalAccessTokens(token.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke access tokens"})
+		return
+	}
+
+	// Proving ownership of the mailbox lifts any lockout on the account
+	if err := loginguard.Default().Succeed(owner.Email); err != nil {
+		log.Printf("Failed to clear login lockout: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+// checkCurrentPassword re-authenticates a logged-in user before a sensitive
+// change. Guessing is throttled like a login.
+func checkCurrentPassword(c *gin.Context, user *models.User, password string) bool {
+	guard := loginguard.Default()
+	wait, locked, err := guard.Check(user.Email, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check login attempts"})
+		return false
+	}
+	if wait > 0 {
+		rejectLoginAttempt(c, wait, locked)
+		return false
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		if err := guard.Fail(user.Email, c.ClientIP()); err != nil {
+			log.Printf("Failed to record failed login: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return false
+	}
+	return true
+}
+
+// ChangePassword lets a logged-in user pick a new password. It needs the
+// current one, logs out every other device and revokes access tokens.
+func ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if user.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This account has no password yet. Use forgot password to set one."})
+		return
+	}
+
+	if !checkCurrentPassword(c, &user, req.CurrentPassword) {
+		return
+	}
+
+	if !validateNewPassword(c, req.NewPassword, user.Email) {
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New password must be different from the current one"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+	if err := database.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"password":   string(hashedPassword),
+		"updated_at": time.Now(),
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	count, err := auth.RevokeOtherSessions(user.ID, c.GetString("sessionID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	// Tokens minted by whoever knew the old password must stop working too
+	if err := auth.RevokeAllPersonalAccessTokens(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke access tokens"})
+		return
+	}
+
+	sendMail(user.Email, "Your IronTrack password was changed", fmt.Sprintf(
+		"Hi %s,\n\nThe password for your IronTrack account was just changed. Your other devices were logged out "+
+			"and your personal access tokens were revoked.\n\n"+
+			"If this wasn't you, reset your password right away with \"Forgot password\" on the login screen.",
+		user.Name))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed", "revokedSessions": count})
+}
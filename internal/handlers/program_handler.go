@@ -0,0 +1,439 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxProgramWeeks   = 52
+	maxDaysPerWeek    = 7
+	defaultDeloadPct  = 60
+	maxRepIncrement   = 10
+	maxWeightIncrease = 50
+)
+
+type ProgramDayInput struct {
+	Name   string `json:"name"`
+	PlanID string `json:"planId"`
+}
+
+type ProgramWeekInput struct {
+	Deload bool              `json:"deload"`
+	Days   []ProgramDayInput `json:"days"`
+}
+
+// ProgramRequest creates or replaces a program. Weeks are numbered in the
+// order given, starting at 1.
+type ProgramRequest struct {
+	Name            string             `json:"name" binding:"required"`
+	Description     string             `json:"description"`
+	WeightIncrement float64            `json:"weightIncrement"`
+	RepIncrement    int                `json:"repIncrement"`
+	DeloadPercent   *int               `json:"deloadPercent"`
+	Weeks           []ProgramWeekInput `json:"weeks" binding:"required"`
+}
+
+type SetCurrentProgramRequest struct {
+	ProgramID string `json:"programId" binding:"required"`
+	Week      int    `json:"week"` // Defaults to 1
+	Day       int    `json:"day"`  // Position within the week, defaults to 0
+}
+
+// ProgramDayResponse is what the user should train next.
+type ProgramDayResponse struct {
+	Progress  models.ProgramProgress  `json:"progress"`
+	Program   *models.Program         `json:"program,omitempty"`
+	Week      *models.ProgramWeek     `json:"week,omitempty"`
+	Day       *models.ProgramDay      `json:"day,omitempty"`
+	Plan      *models.WorkoutPlan     `json:"plan,omitempty"`
+	Exercises []models.ExerciseTarget `json:"exercises,omitempty"`
+	Completed bool                    `json:"completed"`
+}
+
+func preloadProgram(db *gorm.DB) *gorm.DB {
+	return db.
+		Preload("Weeks", func(db *gorm.DB) *gorm.DB { return db.Order("number asc") }).
+		Preload("Weeks.Days", func(db *gorm.DB) *gorm.DB { return db.Order("position asc") })
+}
+
+// loadProgram loads one of the caller's programs, answering 404 if there is none.
+func loadProgram(c *gin.Context, programID string) (*models.Program, bool) {
+	var program models.Program
+	err := preloadProgram(database.DB).Where("id = ? AND user_id = ?", programID, c.GetString("userID")).First(&program).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Program not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load program"})
+		return nil, false
+	}
+	return &program, true
+}
+
+// buildProgram validates a request and turns it into weeks and days. Every
+// day must point at one of the user's own plans.
+func buildProgram(c *gin.Context, req ProgramRequest, program *models.Program) bool {
+	if strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name can't be empty"})
+		return false
+	}
+	if len(req.Weeks) == 0 || len(req.Weeks) > maxProgramWeeks {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A program needs 1 to %d weeks", maxProgramWeeks)})
+		return false
+	}
+	if req.WeightIncrement < 0 || req.WeightIncrement > maxWeightIncrease {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("weightIncrement must be between 0 and %d", maxWeightIncrease)})
+		return false
+	}
+	if req.RepIncrement < 0 || req.RepIncrement > maxRepIncrement {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("repIncrement must be between 0 and %d", maxRepIncrement)})
+		return false
+	}
+	deload := defaultDeloadPct
+	if req.DeloadPercent != nil {
+		deload = *req.DeloadPercent
+	}
+	if deload < 10 || deload > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "deloadPercent must be between 10 and 100"})
+		return false
+	}
+
+	planIDs := map[string]bool{}
+	weeks := make([]models.ProgramWeek, len(req.Weeks))
+	for i, w := range req.Weeks {
+		if len(w.Days) == 0 || len(w.Days) > maxDaysPerWeek {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("weeks[%d] needs 1 to %d days", i, maxDaysPerWeek)})
+			return false
+		}
+		days := make([]models.ProgramDay, len(w.Days))
+		for j, d := range w.Days {
+			if strings.TrimSpace(d.Name) == "" || d.PlanID == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("weeks[%d].days[%d] needs a name and a planId", i, j)})
+				return false
+			}
+			planIDs[d.PlanID] = true
+			days[j] = models.ProgramDay{Position: j, Name: d.Name, PlanID: d.PlanID}
+		}
+		weeks[i] = models.ProgramWeek{Number: i + 1, Deload: w.Deload, Days: days}
+	}
+
+	ids := make([]string, 0, len(planIDs))
+	for id := range planIDs {
+		ids = append(ids, id)
+	}
+	var owned int64
+	if err := database.DB.Model(&models.WorkoutPlan{}).Where("user_id = ? AND id IN ?", c.GetString("userID"), ids).Count(&owned).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check plans"})
+		return false
+	}
+	if int(owned) != len(ids) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Every day must use one of your plans"})
+		return false
+	}
+
+	program.Name = req.Name
+	program.Description = req.Description
+	program.WeightIncrement = req.WeightIncrement
+	program.RepIncrement = req.RepIncrement
+	program.DeloadPercent = deload
+	program.Weeks = weeks
+	return true
+}
+
+func GetPrograms(c *gin.Context) {
+	var programs []models.Program
+	if err := preloadProgram(database.DB).Where("user_id = ?", c.GetString("userID")).Order("created_at desc").Find(&programs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch programs"})
+		return
+	}
+	c.JSON(http.StatusOK, programs)
+}
+
+func GetProgram(c *gin.Context) {
+	program, ok := loadProgram(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, program)
+}
+
+func CreateProgram(c *gin.Context) {
+	var req ProgramRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	program := models.Program{ID: uuid.New().String(), UserID: c.GetString("userID")}
+	if !buildProgram(c, req, &program) {
+		return
+	}
+	if err := database.DB.Create(&program).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create program"})
+		return
+	}
+	c.JSON(http.StatusCreated, program)
+}
+
+// UpdateProgram replaces a program's settings, weeks and days. If the user is
+// following it and their current day no longer exists, they are moved back
+// to the first day of the program.
+func UpdateProgram(c *gin.Context) {
+	var req ProgramRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	program, ok := loadProgram(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if !buildProgram(c, req, program) {
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := deleteProgramWeeks(tx, program.ID); err != nil {
+			return err
+		}
+		if err := tx.Model(program).Select("name", "description", "weight_increment", "rep_increment", "deload_percent", "updated_at").
+			Updates(program).Error; err != nil {
+			return err
+		}
+		for i := range program.Weeks {
+			program.Weeks[i].ProgramID = program.ID
+		}
+		if err := tx.Create(&program.Weeks).Error; err != nil {
+			return err
+		}
+
+		var progress models.ProgramProgress
+		err := tx.Where("user_id = ? AND program_id = ?", program.UserID, program.ID).First(&progress).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, _, found := findProgramDay(program, progress.Week, progress.Day); !found {
+			return tx.Model(&progress).Updates(map[string]interface{}{"week": 1, "day": 0, "updated_at": time.Now()}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update program"})
+		return
+	}
+
+	program, ok = loadProgram(c, program.ID)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, program)
+}
+
+func DeleteProgram(c *gin.Context) {
+	program, ok := loadProgram(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := deleteProgramWeeks(tx, program.ID); err != nil {
+			return err
+		}
+		if err := tx.Where("program_id = ?", program.ID).Delete(&models.ProgramProgress{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(program).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete program"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Program deleted"})
+}
+
+func deleteProgramWeeks(tx *gorm.DB, programID string) error {
+	weekIDs := tx.Model(&models.ProgramWeek{}).Select("id").Where("program_id = ?", programID)
+	if err := tx.Where("week_id IN (?)", weekIDs).Delete(&models.ProgramDay{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("program_id = ?", programID).Delete(&models.ProgramWeek{}).Error
+}
+
+func findProgramDay(program *models.Program, week, day int) (*models.ProgramWeek, *models.ProgramDay, bool) {
+	for i := range program.Weeks {
+		if program.Weeks[i].Number != week {
+			continue
+		}
+		for j := range program.Weeks[i].Days {
+			if program.Weeks[i].Days[j].Position == day {
+				return &program.Weeks[i], &program.Weeks[i].Days[j], true
+			}
+		}
+	}
+	return nil, nil, false
+}
+
+// GetCurrentProgramDay returns the day the user should train next, with the
+// program's progression applied to the plan's targets.
+func GetCurrentProgramDay(c *gin.Context) {
+	var progress models.ProgramProgress
+	if err := database.DB.Where("user_id = ?", c.GetString("userID")).First(&progress).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "You are not following a program"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load program progress"})
+		return
+	}
+	respondProgramDay(c, progress)
+}
+
+func respondProgramDay(c *gin.Context, progress models.ProgramProgress) {
+	program, ok := loadProgram(c, progress.ProgramID)
+	if !ok {
+		return
+	}
+	resp := ProgramDayResponse{Progress: progress, Program: program, Completed: progress.CompletedAt != nil}
+	if resp.Completed {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	week, day, found := findProgramDay(program, progress.Week, progress.Day)
+	if !found {
+		c.JSON(http.StatusConflict, gin.H{"error": "Your current day is no longer part of the program"})
+		return
+	}
+	resp.Week, resp.Day = week, day
+
+	// The plan may have been deleted since; the day is still shown without targets
+	var plan models.WorkoutPlan
+	err := database.DB.Preload("Exercises", orderPlanExercises).Where("id = ? AND user_id = ?", day.PlanID, program.UserID).First(&plan).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load plan"})
+		return
+	}
+	if err == nil {
+		resp.Plan = &plan
+		resp.Exercises = make([]models.ExerciseTarget, len(plan.Exercises))
+		for i, ex := range plan.Exercises {
+			resp.Exercises[i] = program.Targets(week.Number, ex)
+		}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// SetCurrentProgram starts following a program, or jumps to another day of it.
+func SetCurrentProgram(c *gin.Context) {
+	var req SetCurrentProgramRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Week == 0 {
+		req.Week = 1
+	}
+
+	program, ok := loadProgram(c, req.ProgramID)
+	if !ok {
+		return
+	}
+	if _, _, found := findProgramDay(program, req.Week, req.Day); !found {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The program has no such week and day"})
+		return
+	}
+
+	now := time.Now()
+	progress := models.ProgramProgress{
+		UserID:    program.UserID,
+		ProgramID: program.ID,
+		Week:      req.Week,
+		Day:       req.Day,
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+	err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"program_id", "week", "day", "started_at", "updated_at", "completed_at"}),
+	}).Create(&progress).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save program progress"})
+		return
+	}
+	respondProgramDay(c, progress)
+}
+
+// AdvanceProgram moves the user on to the next day of their program. After
+// the last day of the last week the program is marked completed.
+func AdvanceProgram(c *gin.Context) {
+	var progress models.ProgramProgress
+	if err := database.DB.Where("user_id = ?", c.GetString("userID")).First(&progress).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "You are not following a program"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load program progress"})
+		return
+	}
+	if progress.CompletedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The program is already completed"})
+		return
+	}
+
+	program, ok := loadProgram(c, progress.ProgramID)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	progress.UpdatedAt = now
+	if week, day, ok := nextProgramDay(program, progress.Week, progress.Day); ok {
+		progress.Week, progress.Day = week, day
+	} else {
+		progress.CompletedAt = &now
+	}
+	if err := database.DB.Save(&progress).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save program progress"})
+		return
+	}
+	respondProgramDay(c, progress)
+}
+
+// nextProgramDay returns the week number and day position after the given
+// one; ok is false at the end of the program.
+func nextProgramDay(program *models.Program, week, day int) (nextWeek, nextDay int, ok bool) {
+	for _, w := range program.Weeks {
+		for _, d := range w.Days {
+			if w.Number > week || (w.Number == week && d.Position > day) {
+				return w.Number, d.Position, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// StopProgram stops following the current program.
+func StopProgram(c *gin.Context) {
+	if err := database.DB.Where("user_id = ?", c.GetString("userID")).Delete(&models.ProgramProgress{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop program"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Program stopped"})
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+
+	"irontrack-backend/internal/auth"
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,39}$`)
+
+type RoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+type SetUserRolesRequest struct {
+	Roles []string `json:"roles" binding:"required"`
+}
+
+// requireRoleManager stops the request unless the caller may hand out roles.
+// Used where a broader endpoint can also change someone's privileges.
+func requireRoleManager(c *gin.Context) bool {
+	ok, err := auth.HasPermission(c.GetString("userID"), models.PermRolesManage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify permissions"})
+		return false
+	}
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Missing permission: " + models.PermRolesManage})
+		return false
+	}
+	return true
+}
+
+func validatePermissions(c *gin.Context, perms []string) bool {
+	for _, p := range perms {
+		if !models.IsPermission(p) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission: " + p})
+			return false
+		}
+	}
+	return true
+}
+
+func AdminListPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, models.Permissions)
+}
+
+func AdminListRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := database.DB.Preload("Permissions").Order("name asc").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load roles"})
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+func AdminCreateRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !roleNamePattern.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role name must be lowercase letters, digits and underscores"})
+		return
+	}
+	if !validatePermissions(c, req.Permissions) {
+		return
+	}
+
+	var existing models.Role
+	if err := database.DB.Where("name = ?", req.Name).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+		return
+	}
+
+	role := models.Role{Name: req.Name, Description: req.Description}
+	for _, p := range req.Permissions {
+		role.Permissions = append(role.Permissions, models.RolePermission{RoleName: req.Name, Permission: p})
+	}
+	if err := database.DB.Create(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+		return
+	}
+	c.JSON(http.StatusCreated, role)
+}
+
+func AdminUpdateRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !validatePermissions(c, req.Permissions) {
+		return
+	}
+
+	var role models.Role
+	if err := database.DB.Where("name = ?", c.Param("name")).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	if role.BuiltIn {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in roles can't be changed"})
+		return
+	}
+
+	role.Description = req.Description
+	role.Permissions = nil
+	for _, p := range req.Permissions {
+		role.Permissions = append(role.Permissions, models.RolePermission{RoleName: role.Name, Permission: p})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&role).Update("description", role.Description).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_name = ?", role.Name).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		if len(role.Permissions) == 0 {
+			return nil
+		}
+		return tx.Create(&role.Permissions).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+func AdminDeleteRole(c *gin.Context) {
+	var role models.Role
+	if err := database.DB.Where("name = ?", c.Param("name")).First(&role).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+	if role.BuiltIn {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in roles can't be deleted"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM user_roles WHERE role_name = ?", role.Name).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_name = ?", role.Name).Delete(&models.RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
+}
+
+// AdminSetUserRoles replaces the roles assigned to a user.
+func AdminSetUserRoles(c *gin.Context) {
+	var req SetUserRolesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", c.Param("id")).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := auth.SetUserRoles(user.ID, req.Roles); err != nil {
+		if errors.Is(err, auth.ErrUnknownRole) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign roles"})
+		return
+	}
+
+	if err := database.DB.Preload("Roles").Where("id = ?", user.ID).First(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+
+	"irontrack-backend/internal/auth"
+	"irontrack-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionResponse struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// ListSessions returns the caller's active logins across devices.
+func ListSessions(c *gin.Context) {
+	userID := c.GetString("userID")
+	currentID := c.GetString("sessionID")
+
+	sessions, err := auth.ListActiveSessions(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	resp := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, SessionResponse{Session: s, Current: s.ID == currentID})
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RevokeSession logs out one of the caller's devices.
+func RevokeSession(c *gin.Context) {
+	userID := c.GetString("userID")
+	sessionID := c.Param("id")
+
+	found, err := auth.RevokeUserSession(userID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeOtherSessions logs out every device except the one making the request.
+func RevokeOtherSessions(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	count, err := auth.RevokeOtherSessions(userID, c.GetString("sessionID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Other sessions revoked", "count": count})
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ExerciseStats sums up the completed working sets of one exercise. Which
+// fields are filled in depends on what the sets record.
+type ExerciseStats struct {
+	Name          string    `json:"name"`
+	TrackingType  string    `json:"trackingType"`
+	Workouts      int       `json:"workouts"`
+	Sets          int       `json:"sets"`
+	LastPerformed time.Time `json:"lastPerformed"`
+
+	Reps      int     `json:"reps,omitempty"`
+	Volume    float64 `json:"volume,omitempty"` // Sum of weight x reps
+	MaxWeight float64 `json:"maxWeight,omitempty"`
+
+	DurationSeconds        int     `json:"durationSeconds,omitempty"`
+	LongestDurationSeconds int     `json:"longestDurationSeconds,omitempty"`
+	DistanceMeters         float64 `json:"distanceMeters,omitempty"`
+	LongestDistanceMeters  float64 `json:"longestDistanceMeters,omitempty"`
+	// Paces are in seconds per kilometre, over sets with both a distance and a duration
+	AveragePace float64 `json:"averagePaceSecondsPerKm,omitempty"`
+	BestPace    float64 `json:"bestPaceSecondsPerKm,omitempty"`
+}
+
+// exerciseStatsRow is a row of the totals query, grouped by lower-cased name.
+type exerciseStatsRow struct {
+	ExerciseStats
+	ExerciseKey   string
+	PacedDistance float64
+	PacedDuration int
+}
+
+// latestExerciseRow is the most recent time an exercise was logged.
+type latestExerciseRow struct {
+	ExerciseKey  string
+	Name         string
+	TrackingType string
+	Date         time.Time
+}
+
+// Paced sets have both a distance and a duration
+const pacedSet = "log_sets.distance_meters > 0 AND log_sets.duration_seconds > 0"
+
+// GetExerciseStats returns per-exercise totals over the caller's completed
+// workouts, most recently performed first. Warm-up sets and sets not marked
+// completed are left out.
+//
+// Query parameters (all optional):
+//   - from, to: date range, as for GET /logs.
+//   - exercise: case-insensitive substring of the exercise name.
+func GetExerciseStats(c *gin.Context) {
+	from, ok := parseDateParam(c, "from", false)
+	if !ok {
+		return
+	}
+	to, ok := parseDateParam(c, "to", true)
+	if !ok {
+		return
+	}
+	filter := strings.TrimSpace(c.Query("exercise"))
+
+	// The sums are worked out by the database, so long histories aren't loaded
+	exercises := func() *gorm.DB {
+		query := database.DB.Table("log_exercises").
+			Joins("JOIN workout_logs ON workout_logs.id = log_exercises.log_id").
+			Where("workout_logs.user_id = ? AND workout_logs.status = ?", c.GetString("userID"), models.LogStatusCompleted)
+		if from != nil {
+			query = query.Where("workout_logs.date >= ?", *from)
+		}
+		if to != nil {
+			query = query.Where("workout_logs.date < ?", *to)
+		}
+		if filter != "" {
+			query = query.Where("LOWER(TRIM(log_exercises.name)) LIKE ? ESCAPE '\\'", likePattern(filter))
+		}
+		return query
+	}
+
+	var rows []exerciseStatsRow
+	err := exercises().
+		Select(`LOWER(TRIM(log_exercises.name)) AS exercise_key,
+			COUNT(DISTINCT workout_logs.id) AS workouts,
+			COUNT(log_sets.id) AS sets,
+			COALESCE(SUM(log_sets.reps), 0) AS reps,
+			COALESCE(SUM(log_sets.weight * log_sets.reps), 0) AS volume,
+			COALESCE(MAX(log_sets.weight), 0) AS max_weight,
+			COALESCE(SUM(log_sets.duration_seconds), 0) AS duration_seconds,
+			COALESCE(MAX(log_sets.duration_seconds), 0) AS longest_duration_seconds,
+			COALESCE(SUM(log_sets.distance_meters), 0) AS distance_meters,
+			COALESCE(MAX(log_sets.distance_meters), 0) AS longest_distance_meters,
+			COALESCE(SUM(CASE WHEN `+pacedSet+` THEN log_sets.distance_meters ELSE 0 END), 0) AS paced_distance,
+			COALESCE(SUM(CASE WHEN `+pacedSet+` THEN log_sets.duration_seconds ELSE 0 END), 0) AS paced_duration,
+			COALESCE(MIN(CASE WHEN `+pacedSet+` THEN log_sets.duration_seconds * 1000.0 / log_sets.distance_meters END), 0) AS best_pace`).
+		// Exercises without a counted set still show up, with their workouts
+		Joins("LEFT JOIN log_sets ON log_sets.log_exercise_id = log_exercises.id AND log_sets.completed = ? AND log_sets.set_type <> ?",
+			true, models.SetTypeWarmup).
+		Group("exercise_key").
+		Scan(&rows).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stats"})
+		return
+	}
+
+	// Names are shown as last logged, with the tracking type used then
+	var latest []latestExerciseRow
+	err = database.DB.Table("(?) AS ranked", exercises().Select(`LOWER(TRIM(log_exercises.name)) AS exercise_key,
+			log_exercises.name, log_exercises.tracking_type, workout_logs.date,
+			ROW_NUMBER() OVER (PARTITION BY LOWER(TRIM(log_exercises.name))
+				ORDER BY workout_logs.date DESC, log_exercises.position DESC) AS recency`)).
+		Where("recency = 1").
+		Scan(&latest).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch stats"})
+		return
+	}
+	latestByKey := make(map[string]latestExerciseRow, len(latest))
+	for _, row := range latest {
+		latestByKey[row.ExerciseKey] = row
+	}
+
+	result := make([]ExerciseStats, 0, len(rows))
+	for _, row := range rows {
+		stats := row.ExerciseStats
+		last := latestByKey[row.ExerciseKey]
+		stats.Name, stats.TrackingType, stats.LastPerformed = last.Name, last.TrackingType, last.Date
+		if row.PacedDistance > 0 {
+			stats.AveragePace = models.PaceSecondsPerKm(row.PacedDistance, row.PacedDuration)
+		}
+		result = append(result, stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].LastPerformed.Equal(result[j].LastPerformed) {
+			return result[i].LastPerformed.After(result[j].LastPerformed)
+		}
+		return result[i].Name < result[j].Name
+	})
+	c.JSON(http.StatusOK, result)
+}
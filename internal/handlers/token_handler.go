@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"irontrack-backend/internal/auth"
+	"irontrack-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAccessTokenDays = 30
+	maxAccessTokenDays     = 365
+	maxAccessTokensPerUser = 20
+)
+
+type CreateAccessTokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expiresInDays" binding:"omitempty,min=1"`
+}
+
+type CreateAccessTokenResponse struct {
+	models.PersonalAccessToken
+	// Token is only ever returned here, it can't be retrieved later.
+	Token string `json:"token"`
+}
+
+// ListAccessTokenScopes returns the scopes a personal access token can be given.
+func ListAccessTokenScopes(c *gin.Context) {
+	c.JSON(http.StatusOK, models.Scopes)
+}
+
+// ListAccessTokens returns the caller's active personal access tokens.
+func ListAccessTokens(c *gin.Context) {
+	tokens, err := auth.ListPersonalAccessTokens(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch access tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// CreateAccessToken issues a personal access token for scripts and integrations.
+func CreateAccessToken(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req CreateAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	for _, s := range req.Scopes {
+		if !models.IsScope(s) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope: " + s})
+			return
+		}
+	}
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = defaultAccessTokenDays
+	}
+	if req.ExpiresInDays > maxAccessTokenDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Access tokens can be valid for at most 365 days"})
+		return
+	}
+
+	existing, err := auth.ListPersonalAccessTokens(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create access token"})
+		return
+	}
+	if len(existing) >= maxAccessTokensPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many access tokens. Revoke one you no longer use."})
+		return
+	}
+
+	ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	token, plaintext, err := auth.CreatePersonalAccessToken(userID, req.Name, req.Scopes, ttl)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create access token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateAccessTokenResponse{PersonalAccessToken: *token, Token: plaintext})
+}
+
+// RevokeAccessToken revokes one of the caller's personal access tokens.
+func RevokeAccessToken(c *gin.Context) {
+	found, err := auth.RevokePersonalAccessToken(c.GetString("userID"), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke access token"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Access token not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Access token revoked"})
+}
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"irontrack-backend/internal/auth"
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/loginguard"
+	"irontrack-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password     string `json:"password" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+type LoginChallengeRequest struct {
+	ChallengeToken string                    `json:"challengeToken" binding:"required"`
+	Code           string                    `json:"code"`
+	RecoveryCode   string                    `json:"recoveryCode"`
+	WebAuthn       *WebAuthnAssertionRequest `json:"webauthn"`
+	DeviceName     string                    `json:"deviceName"`
+}
+
+func loadCurrentUser(c *gin.Context) (models.User, bool) {
+	var user models.User
+	if err := database.DB.Where("id = ?", c.GetString("userID")).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return user, false
+	}
+	return user, true
+}
+
+// GetTwoFactorStatus reports whether the caller has two-factor authentication set up.
+func GetTwoFactorStatus(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	remaining, err := auth.RecoveryCodesRemaining(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load recovery codes"})
+		return
+	}
+	creds, err := auth.WebAuthnCredentials(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load passkeys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"totpEnabled":            user.TOTPEnabled,
+		"passkeys":               len(creds),
+		"recoveryCodesRemaining": remaining,
+	})
+}
+
+// SetupTOTP starts enrollment by generating a new secret. It has no effect on
+// login until it is confirmed through EnableTOTP.
+func SetupTOTP(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	// Users with a passkey add TOTP from a session that passed it
+	if !requireVerifiedSecondFactor(c, &user) {
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	if err := database.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"totp_secret":       secret,
+		"totp_last_counter": 0,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":     secret,
+		"otpauthUri": auth.TOTPURI(secret, user.Email),
+	})
+}
+
+// EnableTOTP confirms enrollment with a code from the authenticator app and
+// returns the user's recovery codes. They are only ever shown here.
+func EnableTOTP(c *gin.Context) {
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	// Users with a passkey add TOTP from a session that passed it
+	if !requireVerifiedSecondFactor(c, &user) {
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start setup first"})
+		return
+	}
+	if !auth.VerifyUserTOTP(&user, req.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	if err := database.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"totp_enabled": true,
+		"updated_at":   time.Now(),
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	// The user just proved the second factor on this device.
+	_ = auth.MarkSessionTwoFactorVerified(c.GetString("sessionID"))
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+// DisableTOTP turns two-factor authentication off. It needs the password and a
+// current code (or a recovery code) so a stolen session alone can't do it.
+func DisableTOTP(c *gin.Context) {
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+	if !verifySecondFactor(&user, req.Code, req.RecoveryCode) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	if err := database.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"totp_enabled": false,
+		"totp_secret":  "",
+		"updated_at":   time.Now(),
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+	// Keep the recovery codes while passkeys still act as a second factor
+	user.TOTPEnabled = false
+	if enrolled, err := auth.HasSecondFactor(&user); err != nil || !enrolled {
+		if err := auth.DeleteRecoveryCodes(user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recovery codes"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes after checking a current TOTP code.
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !auth.VerifyUserTOTP(&user, req.Code) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+// VerifyLoginChallenge completes a two-step login started by Login.
+func VerifyLoginChallenge(c *gin.Context) {
+	var req LoginChallengeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	challenge, err := auth.LookupUserToken(req.ChallengeToken, auth.TokenPurposeLoginChallenge)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login challenge expired, please log in again"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", challenge.UserID).First(&user).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Wrong codes count like wrong passwords, otherwise the second factor could
+	// be guessed by logging in again with the password after every challenge
+	guard := loginguard.Default()
+	ip := c.ClientIP()
+	wait, locked, err := guard.Check(user.Email, ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check login attempts"})
+		return
+	}
+	if wait > 0 {
+		rejectLoginAttempt(c, wait, locked)
+		return
+	}
+	challengeFailed := func(message string) {
+		_ = auth.RecordUserTokenFailure(challenge.ID)
+		if err := guard.Fail(user.Email, ip); err != nil {
+			log.Printf("Failed to record failed login: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+	}
+
+	if req.WebAuthn != nil {
+		cred, err := verifyWebAuthnAssertion(*req.WebAuthn, auth.WebAuthnPurposeSecondFactor, false)
+		if err != nil || cred.UserID != user.ID {
+			challengeFailed("Passkey verification failed")
+			return
+		}
+	} else if !verifySecondFactor(&user, req.Code, req.RecoveryCode) {
+		challengeFailed("Invalid code")
+		return
+	}
+
+	if _, err := auth.ConsumeUserToken(req.ChallengeToken, auth.TokenPurposeLoginChallenge); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login challenge expired, please log in again"})
+		return
+	}
+	if err := guard.Succeed(user.Email); err != nil {
+		log.Printf("Failed to reset login attempts: %v", err)
+	}
+
+	info := sessionInfo(c, req.DeviceName)
+	info.TwoFactorVerified = true
+	resp, err := newAuthResponse(user, info)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// secondFactorMethods lists the ways the user can answer a login challenge.
+// It is empty when they haven't set up a second factor.
+func secondFactorMethods(user models.User) ([]string, error) {
+	methods := []string{}
+	if user.TOTPEnabled {
+		methods = append(methods, "totp")
+	}
+	creds, err := auth.WebAuthnCredentials(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(creds) > 0 {
+		methods = append(methods, "webauthn")
+	}
+	if len(methods) > 0 {
+		methods = append(methods, "recovery_code")
+	}
+	return methods, nil
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+func verifySecondFactor(user *models.User, code, recoveryCode string) bool {
+	if code != "" {
+		return user.TOTPEnabled && auth.VerifyUserTOTP(user, code)
+	}
+	if recoveryCode != "" {
+		return auth.UseRecoveryCode(user.ID, recoveryCode)
+	}
+	return false
+}
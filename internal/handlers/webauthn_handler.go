@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"irontrack-backend/internal/auth"
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// WebAuthnCredentialJSON is a PublicKeyCredential from the browser with its
+// binary fields base64url-encoded. Registration fills in attestationObject,
+// logins fill in authenticatorData, signature and userHandle.
+type WebAuthnCredentialJSON struct {
+	ID       string `json:"id" binding:"required"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+		AttestationObject string `json:"attestationObject"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+type WebAuthnRegistrationRequest struct {
+	CeremonyID string                 `json:"ceremonyId" binding:"required"`
+	Name       string                 `json:"name" binding:"max=100"`
+	Credential WebAuthnCredentialJSON `json:"credential" binding:"required"`
+}
+
+type WebAuthnAssertionRequest struct {
+	CeremonyID string                 `json:"ceremonyId" binding:"required"`
+	Credential WebAuthnCredentialJSON `json:"credential" binding:"required"`
+}
+
+type PasskeyLoginRequest struct {
+	WebAuthnAssertionRequest
+	DeviceName string `json:"deviceName"`
+}
+
+type WebAuthnSecondFactorRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+}
+
+// requireVerifiedSecondFactor stops users who already have a second factor
+// from changing their factors with a session that didn't pass it.
+func requireVerifiedSecondFactor(c *gin.Context, user *models.User) bool {
+	enrolled, err := auth.HasSecondFactor(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load two-factor status"})
+		return false
+	}
+	if enrolled && !c.GetBool("twoFactorVerified") {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Log in with your second factor to change it",
+			"code":  "two_factor_required",
+		})
+		return false
+	}
+	return true
+}
+
+// BeginWebAuthnRegistration returns the options for navigator.credentials.create().
+func BeginWebAuthnRegistration(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok || !requireVerifiedSecondFactor(c, &user) {
+		return
+	}
+
+	existing, err := auth.WebAuthnCredentials(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load passkeys"})
+		return
+	}
+	ceremony, err := auth.BeginWebAuthnCeremony(user.ID, auth.WebAuthnPurposeRegistration)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey registration"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ceremonyId": ceremony.ID,
+		"publicKey":  auth.NewWebAuthnCreationOptions(user, ceremony.Challenge, existing),
+	})
+}
+
+// FinishWebAuthnRegistration stores the credential the browser created. A
+// user's first second factor also gets recovery codes, shown only here.
+func FinishWebAuthnRegistration(c *gin.Context) {
+	var req WebAuthnRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok || !requireVerifiedSecondFactor(c, &user) {
+		return
+	}
+	hadSecondFactor, err := auth.HasSecondFactor(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load two-factor status"})
+		return
+	}
+
+	ceremony, err := auth.ConsumeWebAuthnCeremony(req.CeremonyID, auth.WebAuthnPurposeRegistration)
+	if err != nil || ceremony.UserID != user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passkey registration expired, please try again"})
+		return
+	}
+
+	clientData, err1 := auth.DecodeWebAuthnBase64(req.Credential.Response.ClientDataJSON)
+	attestation, err2 := auth.DecodeWebAuthnBase64(req.Credential.Response.AttestationObject)
+	if err := errors.Join(err1, err2); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Malformed credential"})
+		return
+	}
+
+	result, err := auth.VerifyWebAuthnRegistration(ceremony.Challenge, clientData, attestation)
+	if err != nil {
+		log.Printf("Passkey registration for %s rejected: %v", user.ID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passkey could not be verified"})
+		return
+	}
+
+	credentialID := strings.TrimRight(req.Credential.ID, "=")
+	if decoded, err := auth.DecodeWebAuthnBase64(credentialID); err != nil || string(decoded) != string(result.CredentialID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Credential ID mismatch"})
+		return
+	}
+	if _, err := auth.FindWebAuthnCredential(credentialID); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "This passkey is already registered"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	cred := models.WebAuthnCredential{
+		ID:           uuid.New().String(),
+		UserID:       user.ID,
+		CredentialID: credentialID,
+		PublicKey:    result.PublicKey,
+		SignCount:    result.SignCount,
+		Name:         name,
+		CreatedAt:    time.Now(),
+	}
+	if err := database.DB.Create(&cred).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save passkey"})
+		return
+	}
+
+	resp := gin.H{"credential": cred}
+	if !hadSecondFactor {
+		codes, err := auth.GenerateRecoveryCodes(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+			return
+		}
+		resp["recoveryCodes"] = codes
+	}
+
+	// The user just proved the second factor on this device.
+	_ = auth.MarkSessionTwoFactorVerified(c.GetString("sessionID"))
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// ListWebAuthnCredentials returns the caller's registered passkeys.
+func ListWebAuthnCredentials(c *gin.Context) {
+	creds, err := auth.WebAuthnCredentials(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load passkeys"})
+		return
+	}
+	c.JSON(http.StatusOK, creds)
+}
+
+// DeleteWebAuthnCredential removes one of the caller's passkeys.
+func DeleteWebAuthnCredential(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok || !requireVerifiedSecondFactor(c, &user) {
+		return
+	}
+
+	result := database.DB.Where("id = ? AND user_id = ?", c.Param("id"), user.ID).Delete(&models.WebAuthnCredential{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete passkey"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+		return
+	}
+
+	// Recovery codes only make sense while there is a second factor to recover
+	if enrolled, err := auth.HasSecondFactor(&user); err == nil && !enrolled {
+		if err := auth.DeleteRecoveryCodes(user.ID); err != nil {
+			log.Printf("Failed to delete recovery codes for %s: %v", user.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey deleted"})
+}
+
+// BeginPasskeyLogin returns the options for a passwordless
+// navigator.credentials.get(). The browser offers any passkey it holds for us.
+func BeginPasskeyLogin(c *gin.Context) {
+	ceremony, err := auth.BeginWebAuthnCeremony("", auth.WebAuthnPurposeLogin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey login"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"ceremonyId": ceremony.ID,
+		"publicKey":  auth.NewWebAuthnRequestOptions(ceremony.Challenge, nil, "required"),
+	})
+}
+
+// FinishPasskeyLogin logs the user in with a passkey. A user-verified passkey
+// already combines possession and a PIN or biometric, so no further second
+// factor is asked for.
+func FinishPasskeyLogin(c *gin.Context) {
+	var req PasskeyLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cred, err := verifyWebAuthnAssertion(req.WebAuthnAssertionRequest, auth.WebAuthnPurposeLogin, true)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Passkey login failed"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", cred.UserID).First(&user).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	info := sessionInfo(c, req.DeviceName)
+	info.TwoFactorVerified = true
+	resp, err := newAuthResponse(user, info)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// BeginWebAuthnSecondFactor returns the options for answering a login
+// challenge with one of the user's passkeys or security keys.
+func BeginWebAuthnSecondFactor(c *gin.Context) {
+	var req WebAuthnSecondFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	challenge, err := auth.LookupUserToken(req.ChallengeToken, auth.TokenPurposeLoginChallenge)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login challenge expired, please log in again"})
+		return
+	}
+
+	creds, err := auth.WebAuthnCredentials(challenge.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load passkeys"})
+		return
+	}
+	if len(creds) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No passkeys registered"})
+		return
+	}
+
+	ceremony, err := auth.BeginWebAuthnCeremony(challenge.UserID, auth.WebAuthnPurposeSecondFactor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey verification"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"ceremonyId": ceremony.ID,
+		"publicKey":  auth.NewWebAuthnRequestOptions(ceremony.Challenge, creds, "discouraged"),
+	})
+}
+
+// verifyWebAuthnAssertion checks a login response against its ceremony and
+// returns the credential that signed it.
+func verifyWebAuthnAssertion(req WebAuthnAssertionRequest, purpose string, requireUV bool) (*models.WebAuthnCredential, error) {
+	ceremony, err := auth.ConsumeWebAuthnCeremony(req.CeremonyID, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := auth.FindWebAuthnCredential(req.Credential.ID)
+	if err != nil {
+		return nil, err
+	}
+	// Second-factor ceremonies are bound to the user who passed the password step
+	if ceremony.UserID != "" && ceremony.UserID != cred.UserID {
+		return nil, auth.ErrUnknownCredential
+	}
+	if req.Credential.Response.UserHandle != "" {
+		handle, err := auth.DecodeWebAuthnBase64(req.Credential.Response.UserHandle)
+		if err != nil || string(handle) != cred.UserID {
+			return nil, auth.ErrUnknownCredential
+		}
+	}
+
+	clientData, err1 := auth.DecodeWebAuthnBase64(req.Credential.Response.ClientDataJSON)
+	authData, err2 := auth.DecodeWebAuthnBase64(req.Credential.Response.AuthenticatorData)
+	signature, err3 := auth.DecodeWebAuthnBase64(req.Credential.Response.Signature)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return nil, auth.ErrWebAuthnInvalid
+	}
+
+	signCount, err := auth.VerifyWebAuthnAssertion(ceremony.Challenge, cred, clientData, authData, signature, requireUV)
+	if err != nil {
+		log.Printf("WebAuthn assertion for credential %s rejected: %v", cred.ID, err)
+		return nil, err
+	}
+	if err := auth.RecordWebAuthnUse(cred, signCount); err != nil {
+		log.Printf("WebAuthn assertion for credential %s rejected: %v", cred.ID, err)
+		return nil, err
+	}
+	return cred, nil
+}
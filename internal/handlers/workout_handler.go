@@ -0,0 +1,756 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type StartFromPlanRequest struct {
+	// Date of the workout; defaults to now.
+	Date *time.Time `json:"date"`
+}
+
+// StartWorkoutFromPlan turns one of the caller's plans into a draft log: one
+// exercise per plan exercise, with WarmupSets warm-up sets followed by
+// DefaultSets working sets of DefaultReps reps. Working sets are pre-filled
+// from the best set of the exercise in the user's most recent completed
+// workout (see lastBestSet), or left at 0 if they never did it.
+func StartWorkoutFromPlan(c *gin.Context) {
+	var req StartFromPlanRequest
+	// The body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userID := c.GetString("userID")
+	var plan models.WorkoutPlan
+	err := database.DB.Preload("Exercises", orderPlanExercises).
+		Where("id = ? AND user_id = ?", c.Param("id"), userID).
+		First(&plan).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Plan not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load plan"})
+		return
+	}
+
+	log, err := draftLogFromPlan(userID, &plan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare workout"})
+		return
+	}
+	if req.Date != nil {
+		log.Date = *req.Date
+	}
+
+	if err := database.DB.Create(log).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create workout"})
+		return
+	}
+	c.JSON(http.StatusCreated, log)
+}
+
+// draftLogFromPlan builds, but doesn't save, a draft log for a plan.
+func draftLogFromPlan(userID string, plan *models.WorkoutPlan) (*models.WorkoutLog, error) {
+	log := &models.WorkoutLog{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Date:      time.Now(),
+		PlanName:  plan.Name,
+		PlanID:    plan.ID,
+		Status:    models.LogStatusDraft,
+		Exercises: make([]models.LogExercise, len(plan.Exercises)),
+	}
+	types, err := trackingTypes(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A plan can list the same exercise twice, e.g. in a superset and later on its own
+	lastBest := map[string]models.LogSet{}
+	for i, pe := range plan.Exercises {
+		trackingType, _ := resolveTrackingType(types, pe.Name, "")
+		key := strings.ToLower(strings.TrimSpace(pe.Name))
+		best, seen := lastBest[key]
+		if !seen {
+			if best, err = lastBestSet(userID, key, trackingType); err != nil {
+				return nil, err
+			}
+			lastBest[key] = best
+		}
+
+		sets := make([]models.LogSet, 0, pe.WarmupSets+pe.DefaultSets)
+		for j := 0; j < pe.WarmupSets; j++ {
+			sets = append(sets, models.LogSet{
+				ID:         uuid.New().String(),
+				Position:   len(sets),
+				SetDetails: models.SetDetails{SetType: models.SetTypeWarmup},
+			})
+		}
+		for j := 0; j < pe.DefaultSets; j++ {
+			set := models.LogSet{
+				ID:       uuid.New().String(),
+				Position: len(sets),
+				SetDetails: models.SetDetails{
+					SetType: models.SetTypeWorking,
+					RPE:     pe.TargetRPE,
+					RIR:     pe.TargetRIR,
+					Tempo:   pe.Tempo,
+				},
+			}
+			switch trackingType {
+			case models.TrackingWeightReps, models.TrackingBodyweightReps:
+				set.Weight, set.Reps = best.Weight, pe.DefaultReps
+			case models.TrackingDuration:
+				set.Weight, set.DurationSeconds = best.Weight, best.DurationSeconds
+			case models.TrackingDistanceDuration:
+				set.DistanceMeters, set.DurationSeconds = best.DistanceMeters, best.DurationSeconds
+			case models.TrackingWeightedDistance:
+				set.Weight, set.DistanceMeters = best.Weight, best.DistanceMeters
+			}
+			sets = append(sets, set)
+		}
+		log.Exercises[i] = models.LogExercise{
+			ID:               uuid.New().String(),
+			Position:         i,
+			Name:             pe.Name,
+			MuscleGroup:      pe.MuscleGroup,
+			Instructions:     pe.Instructions,
+			TrackingType:     trackingType,
+			ExerciseGrouping: pe.ExerciseGrouping,
+			Sets:             sets,
+		}
+	}
+	return log, nil
+}
+
+// lastBestSet returns the best completed set (or, failing that, the best set)
+// of the most recent completed workout that included the exercise, ignoring
+// warm-ups. Best is the heaviest set, the longest for timed exercises and the
+// farthest for distance exercises. name must already be lower-cased.
+func lastBestSet(userID, name, trackingType string) (models.LogSet, error) {
+	var exercise models.LogExercise
+	err := database.DB.Preload("Sets").
+		Joins("JOIN workout_logs ON workout_logs.id = log_exercises.log_id").
+		Where("workout_logs.user_id = ? AND workout_logs.status = ? AND LOWER(log_exercises.name) = ?", userID, models.LogStatusCompleted, name).
+		Order("workout_logs.date desc").
+		Take(&exercise).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.LogSet{}, nil
+	}
+	if err != nil {
+		return models.LogSet{}, err
+	}
+
+	score := func(set models.LogSet) float64 {
+		switch trackingType {
+		case models.TrackingDuration:
+			return float64(set.DurationSeconds)
+		case models.TrackingDistanceDuration:
+			return set.DistanceMeters
+		}
+		return set.Weight
+	}
+	var best, bestCompleted models.LogSet
+	for _, set := range exercise.Sets {
+		if set.SetType == models.SetTypeWarmup {
+			continue
+		}
+		if score(set) > score(best) {
+			best = set
+		}
+		if set.Completed && score(set) > score(bestCompleted) {
+			bestCompleted = set
+		}
+	}
+	if score(bestCompleted) > 0 {
+		return bestCompleted, nil
+	}
+	return best, nil
+}
+
+// --- Live sessions ---
+//
+// A live session is an in-progress log that is saved as the workout happens,
+// one set at a time, so nothing is lost if the app is closed. A user has at
+// most one open session, which any of their devices can pick up through
+// /workouts/current.
+
+type StartWorkoutRequest struct {
+	// LogID starts a draft log; PlanID starts from a plan as
+	// POST /plans/:id/start would. With neither, the session starts empty.
+	LogID    string `json:"logId"`
+	PlanID   string `json:"planId"`
+	PlanName string `json:"planName"`
+}
+
+type WorkoutExerciseRequest struct {
+	// ID lets a client retry an append without adding the exercise twice.
+	ID           string `json:"id"`
+	Name         string `json:"name" binding:"required"`
+	MuscleGroup  string `json:"muscleGroup"`
+	Instructions string `json:"instructions"`
+	TrackingType string `json:"trackingType"`
+	models.ExerciseGrouping
+}
+
+type WorkoutSetRequest struct {
+	// ID lets a client retry an append without adding the set twice.
+	ID        string  `json:"id"`
+	Weight    float64 `json:"weight"`
+	Reps      int     `json:"reps"`
+	Completed bool    `json:"completed"`
+	// DurationSeconds and DistanceMeters are for timed and distance exercises
+	DurationSeconds int     `json:"durationSeconds"`
+	DistanceMeters  float64 `json:"distanceMeters"`
+	models.SetDetails
+}
+
+type UpdateWorkoutSetRequest struct {
+	Weight          *float64 `json:"weight"`
+	Reps            *int     `json:"reps"`
+	Completed       *bool    `json:"completed"`
+	DurationSeconds *int     `json:"durationSeconds"`
+	DistanceMeters  *float64 `json:"distanceMeters"`
+	SetType         *string  `json:"setType"`
+	RPE             *float64 `json:"rpe"`
+	RIR             *int     `json:"rir"`
+	RestSeconds     *int     `json:"restSeconds"`
+	Tempo           *string  `json:"tempo"`
+	Notes           *string  `json:"notes"`
+}
+
+// findOpenWorkout returns the user's in-progress log, or nil if there is none.
+func findOpenWorkout(userID string) (*models.WorkoutLog, error) {
+	var log models.WorkoutLog
+	err := preloadLogExercises(database.DB, true).
+		Where("user_id = ? AND status = ?", userID, models.LogStatusInProgress).
+		Order("started_at desc").
+		Take(&log).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &log, nil
+}
+
+// loadOpenWorkout is findOpenWorkout for handlers, answering 404 if there is
+// no session.
+func loadOpenWorkout(c *gin.Context) (*models.WorkoutLog, bool) {
+	log, err := findOpenWorkout(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load workout"})
+		return nil, false
+	}
+	if log == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No workout in progress"})
+		return nil, false
+	}
+	return log, true
+}
+
+// respondWorkout reloads the session and sends it with its elapsed time.
+func respondWorkout(c *gin.Context, status int, logID string) {
+	var log models.WorkoutLog
+	if err := preloadLogExercises(database.DB, true).Where("id = ?", logID).First(&log).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load workout"})
+		return
+	}
+	log.ElapsedSeconds = int(log.ActiveDuration(time.Now()) / time.Second)
+	c.JSON(status, log)
+}
+
+// StartWorkout opens a live session. If one is already open it is returned
+// with 409, so the client can resume it instead.
+func StartWorkout(c *gin.Context) {
+	var req StartWorkoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	userID := c.GetString("userID")
+	open, err := findOpenWorkout(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load workout"})
+		return
+	}
+	if open != nil {
+		respondAlreadyStarted(c, open)
+		return
+	}
+
+	now := time.Now()
+	switch {
+	case req.LogID != "":
+		var draft models.WorkoutLog
+		if err := database.DB.Where("id = ? AND user_id = ?", req.LogID, userID).First(&draft).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Log not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load log"})
+			return
+		}
+		if draft.Status != models.LogStatusDraft {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only a draft can be started"})
+			return
+		}
+		err := database.DB.Model(&draft).Updates(map[string]interface{}{
+			"status":     models.LogStatusInProgress,
+			"date":       now,
+			"started_at": now,
+		}).Error
+		if err != nil {
+			startFailed(c, userID)
+			return
+		}
+		respondWorkout(c, http.StatusCreated, draft.ID)
+		return
+
+	case req.PlanID != "":
+		var plan models.WorkoutPlan
+		err := database.DB.Preload("Exercises", orderPlanExercises).
+			Where("id = ? AND user_id = ?", req.PlanID, userID).
+			First(&plan).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Plan not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load plan"})
+			return
+		}
+		log, err := draftLogFromPlan(userID, &plan)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare workout"})
+			return
+		}
+		log.Status, log.Date, log.StartedAt = models.LogStatusInProgress, now, &now
+		if err := database.DB.Create(log).Error; err != nil {
+			startFailed(c, userID)
+			return
+		}
+		respondWorkout(c, http.StatusCreated, log.ID)
+		return
+	}
+
+	log := models.WorkoutLog{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Date:      now,
+		PlanName:  req.PlanName,
+		Status:    models.LogStatusInProgress,
+		StartedAt: &now,
+	}
+	if err := database.DB.Create(&log).Error; err != nil {
+		startFailed(c, userID)
+		return
+	}
+	respondWorkout(c, http.StatusCreated, log.ID)
+}
+
+func respondAlreadyStarted(c *gin.Context, open *models.WorkoutLog) {
+	open.ElapsedSeconds = int(open.ActiveDuration(time.Now()) / time.Second)
+	c.JSON(http.StatusConflict, gin.H{"error": "You already have a workout in progress", "workout": open})
+}
+
+// startFailed answers a failed attempt to open a session. Two concurrent starts
+// can both pass the check in StartWorkout; the database's unique index on open
+// sessions then rejects the second, which gets the same 409 as if it had come
+// later.
+func startFailed(c *gin.Context, userID string) {
+	if open, err := findOpenWorkout(userID); err == nil && open != nil {
+		respondAlreadyStarted(c, open)
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start workout"})
+}
+
+// GetCurrentWorkout returns the open session, e.g. to resume it on another device.
+func GetCurrentWorkout(c *gin.Context) {
+	log, ok := loadOpenWorkout(c)
+	if !ok {
+		return
+	}
+	respondWorkout(c, http.StatusOK, log.ID)
+}
+
+// AddWorkoutExercise appends an exercise to the open session.
+func AddWorkoutExercise(c *gin.Context) {
+	var req WorkoutExerciseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name can't be empty"})
+		return
+	}
+	types, err := trackingTypes(c.GetString("userID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load exercises"})
+		return
+	}
+	trackingType, err := resolveTrackingType(types, req.Name, req.TrackingType)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log, ok := loadOpenWorkout(c)
+	if !ok {
+		return
+	}
+
+	position := 0
+	groups := make([]models.ExerciseGrouping, 0, len(log.Exercises)+1)
+	for _, ex := range log.Exercises {
+		if req.ID != "" && ex.ID == req.ID {
+			// A retry of an append that already went through
+			respondWorkout(c, http.StatusOK, log.ID)
+			return
+		}
+		position = max(position, ex.Position+1)
+		groups = append(groups, ex.ExerciseGrouping)
+	}
+	if err := models.ValidateOpenGrouping(append(groups, req.ExerciseGrouping)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	row := models.LogExercise{
+		ID:               req.ID,
+		LogID:            log.ID,
+		Position:         position,
+		Name:             req.Name,
+		MuscleGroup:      req.MuscleGroup,
+		Instructions:     req.Instructions,
+		TrackingType:     trackingType,
+		ExerciseGrouping: req.ExerciseGrouping,
+	}
+	if row.ID == "" {
+		row.ID = uuid.New().String()
+	} else if taken, err := rowExists(database.DB, &models.LogExercise{}, row.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add exercise"})
+		return
+	} else if taken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": (&invalidLogRowError{kind: "Exercise", id: row.ID}).Error()})
+		return
+	}
+	if err := database.DB.Create(&row).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add exercise"})
+		return
+	}
+	respondWorkout(c, http.StatusCreated, log.ID)
+}
+
+// RemoveWorkoutExercise drops an exercise and its sets from the open session.
+func RemoveWorkoutExercise(c *gin.Context) {
+	log, ok := loadOpenWorkout(c)
+	if !ok {
+		return
+	}
+	exercise := findWorkoutExercise(log, c.Param("exerciseId"))
+	if exercise == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exercise not found"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("log_exercise_id = ?", exercise.ID).Delete(&models.LogSet{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", exercise.ID).Delete(&models.LogExercise{}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove exercise"})
+		return
+	}
+	respondWorkout(c, http.StatusOK, log.ID)
+}
+
+func findWorkoutExercise(log *models.WorkoutLog, exerciseID string) *models.LogExercise {
+	for i := range log.Exercises {
+		if log.Exercises[i].ID == exerciseID {
+			return &log.Exercises[i]
+		}
+	}
+	return nil
+}
+
+// findWorkoutSet returns a set of the session and its exercise, or nils.
+func findWorkoutSet(log *models.WorkoutLog, setID string) (*models.LogExercise, *models.LogSet) {
+	for i := range log.Exercises {
+		for j := range log.Exercises[i].Sets {
+			if log.Exercises[i].Sets[j].ID == setID {
+				return &log.Exercises[i], &log.Exercises[i].Sets[j]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// AddWorkoutSet appends a set to an exercise of the open session. Sending
+// the ID of a set that is already there updates it instead, so a client can
+// safely retry.
+func AddWorkoutSet(c *gin.Context) {
+	var req WorkoutSetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.SetDetails.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log, ok := loadOpenWorkout(c)
+	if !ok {
+		return
+	}
+	exercise := findWorkoutExercise(log, c.Param("exerciseId"))
+	if exercise == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exercise not found"})
+		return
+	}
+	fields := models.LogSet{
+		Weight:          req.Weight,
+		Reps:            req.Reps,
+		Completed:       req.Completed,
+		DurationSeconds: req.DurationSeconds,
+		DistanceMeters:  req.DistanceMeters,
+	}
+	if err := models.ValidateSetFields(exercise.TrackingType, fields); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	position := 0
+	for _, set := range exercise.Sets {
+		if req.ID != "" && set.ID == req.ID {
+			set.Weight, set.Reps, set.Completed, set.SetDetails = req.Weight, req.Reps, req.Completed, req.SetDetails
+			set.DurationSeconds, set.DistanceMeters = req.DurationSeconds, req.DistanceMeters
+			if err := database.DB.Save(&set).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save set"})
+				return
+			}
+			respondWorkout(c, http.StatusOK, log.ID)
+			return
+		}
+		position = max(position, set.Position+1)
+	}
+
+	row := models.LogSet{
+		ID:              req.ID,
+		LogExerciseID:   exercise.ID,
+		Position:        position,
+		Weight:          req.Weight,
+		Reps:            req.Reps,
+		Completed:       req.Completed,
+		DurationSeconds: req.DurationSeconds,
+		DistanceMeters:  req.DistanceMeters,
+		SetDetails:      req.SetDetails,
+	}
+	if row.ID == "" {
+		row.ID = uuid.New().String()
+	} else if taken, err := rowExists(database.DB, &models.LogSet{}, row.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save set"})
+		return
+	} else if taken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": (&invalidLogRowError{kind: "Set", id: row.ID}).Error()})
+		return
+	}
+	if err := database.DB.Create(&row).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save set"})
+		return
+	}
+	respondWorkout(c, http.StatusCreated, log.ID)
+}
+
+// UpdateWorkoutSet changes the given fields of a set in the open session.
+// Fields left out keep their value.
+func UpdateWorkoutSet(c *gin.Context) {
+	var req UpdateWorkoutSetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	log, ok := loadOpenWorkout(c)
+	if !ok {
+		return
+	}
+	exercise, set := findWorkoutSet(log, c.Param("setId"))
+	if set == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Set not found"})
+		return
+	}
+
+	if req.Weight != nil {
+		set.Weight = *req.Weight
+	}
+	if req.Reps != nil {
+		set.Reps = *req.Reps
+	}
+	if req.Completed != nil {
+		set.Completed = *req.Completed
+	}
+	if req.DurationSeconds != nil {
+		set.DurationSeconds = *req.DurationSeconds
+	}
+	if req.DistanceMeters != nil {
+		set.DistanceMeters = *req.DistanceMeters
+	}
+	if err := models.ValidateSetFields(exercise.TrackingType, *set); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.SetType != nil {
+		set.SetType = *req.SetType
+	}
+	if req.RPE != nil {
+		set.RPE = req.RPE
+	}
+	if req.RIR != nil {
+		set.RIR = req.RIR
+	}
+	if req.RestSeconds != nil {
+		set.RestSeconds = req.RestSeconds
+	}
+	if req.Tempo != nil {
+		set.Tempo = *req.Tempo
+	}
+	if req.Notes != nil {
+		set.Notes = *req.Notes
+	}
+	if err := set.SetDetails.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := database.DB.Save(set).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save set"})
+		return
+	}
+	respondWorkout(c, http.StatusOK, log.ID)
+}
+
+// DeleteWorkoutSet removes a set from the open session.
+func DeleteWorkoutSet(c *gin.Context) {
+	log, ok := loadOpenWorkout(c)
+	if !ok {
+		return
+	}
+	_, set := findWorkoutSet(log, c.Param("setId"))
+	if set == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Set not found"})
+		return
+	}
+	if err := database.DB.Where("id = ?", set.ID).Delete(&models.LogSet{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete set"})
+		return
+	}
+	respondWorkout(c, http.StatusOK, log.ID)
+}
+
+// PauseWorkout stops the session clock until ResumeWorkout.
+func PauseWorkout(c *gin.Context) {
+	log, ok := loadOpenWorkout(c)
+	if !ok {
+		return
+	}
+	if log.PausedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "The workout is already paused"})
+		return
+	}
+	if err := database.DB.Model(log).Update("paused_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pause workout"})
+		return
+	}
+	respondWorkout(c, http.StatusOK, log.ID)
+}
+
+// ResumeWorkout restarts the session clock after a pause.
+func ResumeWorkout(c *gin.Context) {
+	log, ok := loadOpenWorkout(c)
+	if !ok {
+		return
+	}
+	if log.PausedAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "The workout isn't paused"})
+		return
+	}
+	err := database.DB.Model(log).Updates(map[string]interface{}{
+		"paused_at":      nil,
+		"paused_seconds": log.PausedSeconds + pausedSeconds(log, time.Now()),
+	}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resume workout"})
+		return
+	}
+	respondWorkout(c, http.StatusOK, log.ID)
+}
+
+// pausedSeconds is the length of the current pause, if any.
+func pausedSeconds(log *models.WorkoutLog, now time.Time) int {
+	if log.PausedAt == nil {
+		return 0
+	}
+	return int(now.Sub(*log.PausedAt) / time.Second)
+}
+
+// FinishWorkout completes the open session. Its duration is the time since
+// it started, less pauses, rounded to the minute.
+func FinishWorkout(c *gin.Context) {
+	log, ok := loadOpenWorkout(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	log.PausedSeconds += pausedSeconds(log, now)
+	log.PausedAt = nil
+	log.FinishedAt = &now
+	duration := log.ActiveDuration(now)
+
+	err := database.DB.Model(log).Updates(map[string]interface{}{
+		"status":           models.LogStatusCompleted,
+		"paused_at":        nil,
+		"paused_seconds":   log.PausedSeconds,
+		"finished_at":      now,
+		"duration_minutes": int(duration.Round(time.Minute) / time.Minute),
+	}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to finish workout"})
+		return
+	}
+	respondWorkout(c, http.StatusOK, log.ID)
+}
+
+// DiscardWorkout deletes the open session and everything recorded in it.
+func DiscardWorkout(c *gin.Context) {
+	log, ok := loadOpenWorkout(c)
+	if !ok {
+		return
+	}
+	if err := deleteLog(log.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to discard workout"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Workout discarded"})
+}
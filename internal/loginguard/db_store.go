@@ -0,0 +1,79 @@
+package loginguard
+
+import (
+	"errors"
+	"time"
+
+	"irontrack-backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DBStore keeps counters in the login_attempts table, so they survive restarts
+// and are shared by every instance behind the load balancer.
+type DBStore struct {
+	db *gorm.DB
+}
+
+func NewDBStore(db *gorm.DB) *DBStore {
+	return &DBStore{db: db}
+}
+
+func (s *DBStore) Get(key string) (*Entry, error) {
+	var row models.LoginAttempt
+	err := s.db.Where("key = ?", key).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entryFromRow(row), nil
+}
+
+func (s *DBStore) RecordFailure(key string, now time.Time, resetAfter time.Duration) (*Entry, error) {
+	// A single upsert keeps concurrent failures from losing counts
+	err := s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failures": gorm.Expr(
+				"CASE WHEN login_attempts.last_failure_at < ? THEN 1 ELSE login_attempts.failures + 1 END",
+				now.Add(-resetAfter)),
+			"last_failure_at": now,
+		}),
+	}).Create(&models.LoginAttempt{Key: key, Failures: 1, LastFailureAt: now}).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(key)
+}
+
+func (s *DBStore) Lock(key string, until time.Time) error {
+	return s.db.Model(&models.LoginAttempt{}).Where("key = ?", key).Update("locked_until", until).Error
+}
+
+func (s *DBStore) Reset(key string) error {
+	return s.db.Where("key = ?", key).Delete(&models.LoginAttempt{}).Error
+}
+
+func (s *DBStore) List(since time.Time) ([]Entry, error) {
+	var rows []models.LoginAttempt
+	if err := s.db.Where("last_failure_at >= ?", since).Order("last_failure_at desc").Limit(500).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make([]Entry, len(rows))
+	for i, row := range rows {
+		out[i] = *entryFromRow(row)
+	}
+	return out, nil
+}
+
+func entryFromRow(row models.LoginAttempt) *Entry {
+	return &Entry{
+		Key:           row.Key,
+		Failures:      row.Failures,
+		LastFailureAt: row.LastFailureAt,
+		LockedUntil:   row.LockedUntil,
+	}
+}
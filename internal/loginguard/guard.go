@@ -0,0 +1,216 @@
+// Package loginguard throttles password guessing. Failed logins are counted
+// per account and per client IP; past a few failures each further attempt has
+// to wait progressively longer, and too many failures lock the key for a while.
+package loginguard
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"irontrack-backend/internal/database"
+)
+
+// Policy controls how quickly a key is throttled.
+type Policy struct {
+	// FreeAttempts is how many failures are allowed before delays kick in.
+	FreeAttempts int
+	// BaseDelay is the wait after the first throttled failure; it doubles with
+	// each further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutAfter failures lock the key for LockoutDuration.
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	// ResetAfter without a failure forgets the count.
+	ResetAfter time.Duration
+}
+
+// DefaultAccountPolicy applies to a single email address.
+var DefaultAccountPolicy = Policy{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        30 * time.Second,
+	LockoutAfter:    10,
+	LockoutDuration: 15 * time.Minute,
+	ResetAfter:      time.Hour,
+}
+
+// DefaultIPPolicy applies to a client IP. It is looser since many users can
+// share an address behind NAT.
+var DefaultIPPolicy = Policy{
+	FreeAttempts:    20,
+	BaseDelay:       time.Second,
+	MaxDelay:        30 * time.Second,
+	LockoutAfter:    100,
+	LockoutDuration: 15 * time.Minute,
+	ResetAfter:      time.Hour,
+}
+
+// Guard decides whether a login attempt may proceed.
+type Guard struct {
+	Store   Store
+	Account Policy
+	IP      Policy
+	// Now is the clock, replaceable in tests.
+	Now func() time.Time
+}
+
+// New returns a guard with the default policies.
+func New(store Store) *Guard {
+	return &Guard{
+		Store:   store,
+		Account: DefaultAccountPolicy,
+		IP:      DefaultIPPolicy,
+		Now:     time.Now,
+	}
+}
+
+// AccountKey and IPKey build the store keys for an email and a client IP.
+func AccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check reports how long the caller must wait before trying to log in to
+// email from ip. Zero means the attempt may go ahead. locked is true when the
+// wait is due to a lockout rather than a progressive delay.
+func (g *Guard) Check(email, ip string) (wait time.Duration, locked bool, err error) {
+	now := g.Now()
+	for _, k := range []struct {
+		key    string
+		policy Policy
+	}{{AccountKey(email), g.Account}, {IPKey(ip), g.IP}} {
+		entry, err := g.Store.Get(k.key)
+		if err != nil {
+			return 0, false, err
+		}
+		w, l := k.policy.wait(entry, now)
+		if w > wait {
+			wait, locked = w, l
+		}
+	}
+	return wait, locked, nil
+}
+
+// Fail records a failed login to email from ip, locking either key once it
+// crosses its policy's threshold.
+func (g *Guard) Fail(email, ip string) error {
+	now := g.Now()
+	for _, k := range []struct {
+		key    string
+		policy Policy
+	}{{AccountKey(email), g.Account}, {IPKey(ip), g.IP}} {
+		entry, err := g.Store.RecordFailure(k.key, now, k.policy.ResetAfter)
+		if err != nil {
+			return err
+		}
+		if entry.Failures >= k.policy.LockoutAfter {
+			if err := g.Store.Lock(k.key, now.Add(k.policy.LockoutDuration)); err != nil {
+				return err
+			}
+			log.Printf("Login lockout for %s after %d failed attempts", k.key, entry.Failures)
+		}
+	}
+	return nil
+}
+
+// Succeed clears the account's counter after a good password. The IP counter
+// is left alone, otherwise an attacker could reset it by logging in to their
+// own account between guesses.
+func (g *Guard) Succeed(email string) error {
+	return g.Store.Reset(AccountKey(email))
+}
+
+// Unlock clears a key, e.g. from the admin dashboard.
+func (g *Guard) Unlock(key string) error {
+	return g.Store.Reset(key)
+}
+
+// Active lists keys with recent failures.
+func (g *Guard) Active() ([]Entry, error) {
+	since := g.Now().Add(-max(g.Account.ResetAfter, g.IP.ResetAfter, g.Account.LockoutDuration, g.IP.LockoutDuration))
+	return g.Store.List(since)
+}
+
+func (p Policy) wait(entry *Entry, now time.Time) (time.Duration, bool) {
+	if entry == nil {
+		return 0, false
+	}
+	// A lockout may outlast ResetAfter, so it is checked first
+	if entry.LockedUntil != nil && now.Before(*entry.LockedUntil) {
+		return entry.LockedUntil.Sub(now), true
+	}
+	if now.Sub(entry.LastFailureAt) > p.ResetAfter {
+		return 0, false
+	}
+	if entry.Failures < p.FreeAttempts {
+		return 0, false
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts; i < entry.Failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.MaxDelay)
+	if next := entry.LastFailureAt.Add(delay); now.Before(next) {
+		return next.Sub(now), false
+	}
+	return 0, false
+}
+
+var (
+	defaultMu    sync.RWMutex
+	defaultGuard *Guard
+)
+
+// SetDefault replaces the process-wide guard. Tests use it to get a fresh store and clock.
+func SetDefault(g *Guard) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultGuard = g
+}
+
+// Default returns the process-wide guard, creating it from the environment if needed.
+func Default() *Guard {
+	defaultMu.RLock()
+	g := defaultGuard
+	defaultMu.RUnlock()
+	if g != nil {
+		return g
+	}
+
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultGuard == nil {
+		defaultGuard = FromEnv()
+	}
+	return defaultGuard
+}
+
+// FromEnv builds a guard from LOGIN_GUARD_STORE ("db", the default, or
+// "memory"). LOGIN_MAX_FAILURES and LOGIN_LOCKOUT override the account
+// lockout threshold and duration.
+func FromEnv() *Guard {
+	var store Store
+	if os.Getenv("LOGIN_GUARD_STORE") == "memory" {
+		store = NewMemoryStore()
+	} else {
+		store = NewDBStore(database.DB)
+	}
+
+	g := New(store)
+	if n, err := strconv.Atoi(os.Getenv("LOGIN_MAX_FAILURES")); err == nil && n > 0 {
+		g.Account.LockoutAfter = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOGIN_LOCKOUT")); err == nil && d > 0 {
+		g.Account.LockoutDuration = d
+	}
+	return g
+}
@@ -0,0 +1,112 @@
+package loginguard
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Entry is the failed-login record for one key (an account or a client IP).
+type Entry struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"lastFailureAt"`
+	LockedUntil   *time.Time `json:"lockedUntil,omitempty"`
+}
+
+// Store persists failed-login counters. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Get returns the entry for key, or nil if there is none.
+	Get(key string) (*Entry, error)
+	// RecordFailure counts a failed attempt and returns the updated entry. The
+	// count starts over when the previous failure is older than resetAfter.
+	RecordFailure(key string, now time.Time, resetAfter time.Duration) (*Entry, error)
+	// Lock blocks the key until the given time.
+	Lock(key string, until time.Time) error
+	// Reset forgets everything about the key.
+	Reset(key string) error
+	// List returns entries with a failure since the given time, newest first.
+	List(since time.Time) ([]Entry, error)
+}
+
+// maxMemoryEntries bounds MemoryStore; past it, stale entries are swept.
+const maxMemoryEntries = 10000
+
+// MemoryStore keeps counters in process memory. Counters are lost on restart
+// and not shared between instances, so prefer DBStore when running more than one.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]*Entry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]*Entry{}}
+}
+
+func (s *MemoryStore) Get(key string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	out := *e
+	return &out, nil
+}
+
+func (s *MemoryStore) RecordFailure(key string, now time.Time, resetAfter time.Duration) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.entries) >= maxMemoryEntries {
+		for k, e := range s.entries {
+			if now.Sub(e.LastFailureAt) > resetAfter && (e.LockedUntil == nil || !now.Before(*e.LockedUntil)) {
+				delete(s.entries, k)
+			}
+		}
+	}
+
+	e, ok := s.entries[key]
+	if !ok || now.Sub(e.LastFailureAt) > resetAfter {
+		e = &Entry{Key: key}
+		s.entries[key] = e
+	}
+	e.Failures++
+	e.LastFailureAt = now
+
+	out := *e
+	return &out, nil
+}
+
+func (s *MemoryStore) Lock(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		e = &Entry{Key: key, LastFailureAt: time.Now()}
+		s.entries[key] = e
+	}
+	e.LockedUntil = &until
+	return nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) List(since time.Time) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Entry{}
+	for _, e := range s.entries {
+		if !e.LastFailureAt.Before(since) {
+			out = append(out, *e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastFailureAt.After(out[j].LastFailureAt) })
+	return out, nil
+}
@@ -0,0 +1,93 @@
+package mail
+
+import (
+	"context"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Mailer delivers transactional email such as password reset links.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var (
+	defaultMu sync.RWMutex
+	// defaultMailer is built from the environment on first use unless SetDefault was called.
+	defaultMailer Mailer
+)
+
+// SetDefault replaces the mailer used by Send. Tests use it to capture outgoing mail.
+func SetDefault(m Mailer) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultMailer = m
+}
+
+// Default returns the process-wide mailer, creating it from the environment if needed.
+func Default() Mailer {
+	defaultMu.RLock()
+	m := defaultMailer
+	defaultMu.RUnlock()
+	if m != nil {
+		return m
+	}
+
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	if defaultMailer == nil {
+		defaultMailer = FromEnv()
+	}
+	return defaultMailer
+}
+
+// Send delivers msg through the default mailer.
+func Send(ctx context.Context, msg Message) error {
+	return Default().Send(ctx, msg)
+}
+
+// FromEnv builds a mailer from MAIL_DRIVER:
+//   - "smtp": SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD, MAIL_FROM
+//   - "file": appends messages to MAIL_FILE (local development)
+//   - anything else: nothing is sent; recipients and subjects are logged
+func FromEnv() Mailer {
+	switch os.Getenv("MAIL_DRIVER") {
+	case "smtp":
+		port, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
+		if port == 0 {
+			port = 587
+		}
+		return &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     fromAddress(),
+		}
+	case "file":
+		if path := os.Getenv("MAIL_FILE"); path != "" {
+			return NewFileMailer(path)
+		}
+		log.Println("MAIL_DRIVER=file needs MAIL_FILE, outgoing email will not be delivered")
+		return LogMailer{}
+	default:
+		log.Println("MAIL_DRIVER not set, outgoing email will not be delivered")
+		return LogMailer{}
+	}
+}
+
+func fromAddress() string {
+	if from := os.Getenv("MAIL_FROM"); from != "" {
+		return from
+	}
+	return "IronTrack <no-reply@irontrack.local>"
+}
@@ -0,0 +1,83 @@
+package models
+
+import "fmt"
+
+// Group types for exercises performed back to back.
+const (
+	GroupTypeSuperset = "superset"
+	GroupTypeCircuit  = "circuit"
+	GroupTypeGiantSet = "giant_set"
+)
+
+// ExerciseGrouping places an exercise of a plan or log in a superset, circuit
+// or giant set. Exercises sharing a GroupID are done back to back and must be
+// listed next to each other with the same GroupType and RestSeconds.
+type ExerciseGrouping struct {
+	GroupID   string `gorm:"type:text" json:"groupId,omitempty"`
+	GroupType string `gorm:"type:text" json:"groupType,omitempty"`
+	// RestSeconds is the rest after each set, or after each round for a group.
+	RestSeconds int `gorm:"not null;default:0" json:"restSeconds,omitempty"`
+}
+
+// ValidateGrouping checks the grouping of an ordered exercise list.
+func ValidateGrouping(items []ExerciseGrouping) error {
+	return validateGrouping(items, false)
+}
+
+// ValidateOpenGrouping is ValidateGrouping for a list that is still being
+// appended to, such as a live session: the group of the last exercise may not
+// have all its members yet, so it isn't held to the minimum size.
+func ValidateOpenGrouping(items []ExerciseGrouping) error {
+	return validateGrouping(items, true)
+}
+
+func validateGrouping(items []ExerciseGrouping, open bool) error {
+	type group struct {
+		first, last, size int
+	}
+	groups := map[string]*group{}
+	for i, item := range items {
+		if item.RestSeconds < 0 || item.RestSeconds > 3600 {
+			return fmt.Errorf("exercises[%d].restSeconds must be between 0 and 3600", i)
+		}
+		if item.GroupID == "" {
+			if item.GroupType != "" {
+				return fmt.Errorf("exercises[%d] has a groupType but no groupId", i)
+			}
+			continue
+		}
+		switch item.GroupType {
+		case GroupTypeSuperset, GroupTypeCircuit, GroupTypeGiantSet:
+		default:
+			return fmt.Errorf("exercises[%d].groupType must be superset, circuit or giant_set", i)
+		}
+
+		g, ok := groups[item.GroupID]
+		if !ok {
+			groups[item.GroupID] = &group{first: i, last: i, size: 1}
+			continue
+		}
+		if g.last != i-1 {
+			return fmt.Errorf("exercises of group %q must be listed next to each other", item.GroupID)
+		}
+		if first := items[g.first]; item.GroupType != first.GroupType || item.RestSeconds != first.RestSeconds {
+			return fmt.Errorf("exercises of group %q must share groupType and restSeconds", item.GroupID)
+		}
+		g.last = i
+		g.size++
+	}
+
+	for id, g := range groups {
+		if open && g.last == len(items)-1 {
+			continue
+		}
+		minSize := 2
+		if items[g.first].GroupType == GroupTypeGiantSet {
+			minSize = 3
+		}
+		if g.size < minSize {
+			return fmt.Errorf("group %q needs at least %d exercises", id, minSize)
+		}
+	}
+	return nil
+}
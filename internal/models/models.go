@@ -11,11 +11,27 @@ type User struct {
 	Email     string         `gorm:"uniqueIndex;type:text" json:"email"`
 	Password  string         `gorm:"type:text" json:"-"` // Stored as hash
 	Name      string         `gorm:"type:text" json:"name"`
-	IsAdmin   bool           `gorm:"default:false" json:"isAdmin"`
+	IsAdmin   bool           `gorm:"default:false" json:"isAdmin"` // Mirrors membership of the built-in admin role
 	CreatedAt time.Time      `json:"createdAt"`
 	UpdatedAt time.Time      `json:"updatedAt"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
+	EmailVerified   bool       `gorm:"default:false" json:"emailVerified"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt,omitempty"`
+
+	// DeletionScheduledAt is when a requested account deletion will be carried out.
+	DeletionScheduledAt *time.Time `gorm:"index" json:"deletionScheduledAt,omitempty"`
+
+	// TOTPSecret is set during enrollment and only takes effect once TOTPEnabled is true.
+	TOTPSecret      string `gorm:"type:text" json:"-"`
+	TOTPEnabled     bool   `gorm:"default:false" json:"totpEnabled"`
+	TOTPLastCounter int64  `json:"-"` // Last accepted time step, so a code can't be replayed
+
+	Roles       []Role   `gorm:"many2many:user_roles;constraint:OnDelete:CASCADE;" json:"roles,omitempty"`
+	Permissions []string `gorm:"-" json:"permissions,omitempty"`
+	// ImpersonatedBy is set on /me when a staff user is acting as this user.
+	ImpersonatedBy string `gorm:"-" json:"impersonatedBy,omitempty"`
+
 	// Relations
 	Plans      []WorkoutPlan        `gorm:"foreignKey:UserID" json:"plans,omitempty"`
 	Logs       []WorkoutLog         `gorm:"foreignKey:UserID" json:"logs,omitempty"`
@@ -24,6 +40,19 @@ type User struct {
 	AIRequests []AIRequestLog       `gorm:"foreignKey:UserID" json:"aiRequests,omitempty"`
 }
 
+// Role is a named set of permissions that can be assigned to users.
+type Role struct {
+	Name        string           `gorm:"primaryKey;type:text" json:"name"`
+	Description string           `gorm:"type:text" json:"description"`
+	BuiltIn     bool             `gorm:"default:false" json:"builtIn"`
+	Permissions []RolePermission `gorm:"foreignKey:RoleName;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"permissions"`
+}
+
+type RolePermission struct {
+	RoleName   string `gorm:"primaryKey;type:text" json:"-"`
+	Permission string `gorm:"primaryKey;type:text" json:"permission"`
+}
+
 type UserProfile struct {
 	UserID          string `gorm:"primaryKey;type:text" json:"userId"`
 	Gender          string `json:"gender"`
@@ -43,6 +72,8 @@ type ExerciseDefinition struct {
 	Name         string  `gorm:"type:text" json:"name"`
 	MuscleGroup  string  `gorm:"type:text" json:"muscleGroup"`
 	Instructions string  `gorm:"type:text" json:"instructions,omitempty"`
+	// TrackingType is what its sets record; see the Tracking constants.
+	TrackingType string `gorm:"type:text;not null;default:weight_reps" json:"trackingType"`
 }
 
 type WorkoutPlan struct {
@@ -58,21 +89,44 @@ type WorkoutPlan struct {
 }
 
 type PlanExercise struct {
-	ID           uint   `gorm:"primaryKey" json:"-"`
+	ID           uint   `gorm:"primaryKey" json:"id"`
 	PlanID       string `gorm:"index;type:text" json:"-"`
+	Position     int    `gorm:"not null;default:0" json:"position"` // Order within the plan, from 0
 	Name         string `gorm:"type:text" json:"name"`
 	DefaultSets  int    `json:"defaultSets"`
 	DefaultReps  int    `json:"defaultReps"`
 	MuscleGroup  string `json:"muscleGroup,omitempty"`
 	Instructions string `json:"instructions,omitempty"`
+	ExerciseGrouping
+	ExerciseTargets
 }
 
+// Log statuses. A draft is a workout that has been set up (e.g. from a plan)
+// but not started; an in-progress log is a live session being recorded set by
+// set. Only completed logs count as history.
+const (
+	LogStatusDraft      = "draft"
+	LogStatusInProgress = "in_progress"
+	LogStatusCompleted  = "completed"
+)
+
 type WorkoutLog struct {
 	ID              string    `gorm:"primaryKey;type:text" json:"id"`
 	UserID          string    `gorm:"index;type:text" json:"userId"`
 	Date            time.Time `gorm:"index" json:"date"`
 	DurationMinutes int       `json:"durationMinutes"`
 	PlanName        string    `json:"planName,omitempty"`
+	PlanID          string    `gorm:"index;type:text" json:"planId,omitempty"` // Plan the workout was started from
+	Status          string    `gorm:"type:text;not null;default:completed;index" json:"status"`
+
+	// Timing of a live session. DurationMinutes of a session is computed from
+	// these when it is finished.
+	StartedAt     *time.Time `json:"startedAt,omitempty"`
+	PausedAt      *time.Time `json:"pausedAt,omitempty"`
+	PausedSeconds int        `gorm:"not null;default:0" json:"pausedSeconds,omitempty"`
+	FinishedAt    *time.Time `json:"finishedAt,omitempty"`
+	// ElapsedSeconds is the active time so far, filled in for live sessions.
+	ElapsedSeconds int `gorm:"-" json:"elapsedSeconds,omitempty"`
 
 	Exercises []LogExercise `gorm:"foreignKey:LogID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"exercises"`
 }
@@ -80,9 +134,13 @@ type WorkoutLog struct {
 type LogExercise struct {
 	ID           string `gorm:"primaryKey;type:text" json:"id"`
 	LogID        string `gorm:"index;type:text" json:"-"`
+	Position     int    `gorm:"not null;default:0" json:"position"` // Order within the log, from 0
 	Name         string `gorm:"type:text" json:"name"`
 	MuscleGroup  string `json:"muscleGroup,omitempty"`
 	Instructions string `json:"instructions,omitempty"`
+	// TrackingType defaults to the one of the exercise definition with the same name.
+	TrackingType string `gorm:"type:text;not null;default:weight_reps" json:"trackingType"`
+	ExerciseGrouping
 
 	Sets []LogSet `gorm:"foreignKey:LogExerciseID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"sets"`
 }
@@ -90,9 +148,167 @@ type LogExercise struct {
 type LogSet struct {
 	ID            string  `gorm:"primaryKey;type:text" json:"id"`
 	LogExerciseID string  `gorm:"index;type:text" json:"-"`
+	Position      int     `gorm:"not null;default:0" json:"position"` // Order within the exercise, from 0
 	Weight        float64 `json:"weight"`
 	Reps          int     `json:"reps"`
 	Completed     bool    `json:"completed"`
+	// For timed and distance exercises, depending on the exercise's TrackingType
+	DurationSeconds int     `gorm:"not null;default:0" json:"durationSeconds,omitempty"`
+	DistanceMeters  float64 `gorm:"not null;default:0" json:"distanceMeters,omitempty"`
+	SetDetails
+}
+
+// ActiveDuration is the time spent in a live session up to now, leaving out
+// pauses. It is zero for logs that weren't recorded as a session.
+func (l *WorkoutLog) ActiveDuration(now time.Time) time.Duration {
+	if l.StartedAt == nil {
+		return 0
+	}
+	end := now
+	if l.FinishedAt != nil {
+		end = *l.FinishedAt
+	} else if l.PausedAt != nil {
+		end = *l.PausedAt
+	}
+	d := end.Sub(*l.StartedAt) - time.Duration(l.PausedSeconds)*time.Second
+	return max(d, 0)
+}
+
+// Session is a login on a single device. Access tokens carry the session ID and
+// the refresh token (stored only as a hash) is rotated on every refresh.
+type Session struct {
+	ID               string     `gorm:"primaryKey;type:text" json:"id"`
+	UserID           string     `gorm:"index;type:text" json:"userId"`
+	RefreshTokenHash string     `gorm:"uniqueIndex;type:text" json:"-"`
+	DeviceName       string     `gorm:"type:text" json:"deviceName"`
+	UserAgent        string     `gorm:"type:text" json:"userAgent"`
+	IPAddress        string     `gorm:"type:text" json:"ipAddress"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	LastSeenAt       time.Time  `json:"lastSeenAt"`
+	ExpiresAt        time.Time  `gorm:"index" json:"expiresAt"`
+	RevokedAt        *time.Time `gorm:"index" json:"revokedAt,omitempty"`
+	// TwoFactorVerified is true when the login that started this session passed a second factor.
+	TwoFactorVerified bool `gorm:"default:false" json:"twoFactorVerified"`
+	// ImpersonatorID is the staff user acting through this session, if any.
+	ImpersonatorID string `gorm:"index;type:text" json:"impersonatorId,omitempty"`
+}
+
+// UserToken is a single-use, expiring token mailed to a user, e.g. for a
+// password reset. Only the hash of the token is stored.
+type UserToken struct {
+	ID        string     `gorm:"primaryKey;type:text" json:"id"`
+	UserID    string     `gorm:"index;type:text" json:"userId"`
+	Purpose   string     `gorm:"index;type:text" json:"purpose"`
+	TokenHash string     `gorm:"uniqueIndex;type:text" json:"-"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+	Attempts  int        `gorm:"default:0" json:"-"` // Failed attempts, for tokens that guard a code entry
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// RecoveryCode is a one-time backup code for a user with two-factor authentication.
+type RecoveryCode struct {
+	ID        string     `gorm:"primaryKey;type:text" json:"id"`
+	UserID    string     `gorm:"index;type:text" json:"userId"`
+	CodeHash  string     `gorm:"index;type:text" json:"-"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// UserIdentity links a user to an account at an external OpenID Connect provider.
+type UserIdentity struct {
+	ID        string    `gorm:"primaryKey;type:text" json:"id"`
+	UserID    string    `gorm:"index;type:text" json:"userId"`
+	Provider  string    `gorm:"uniqueIndex:idx_identity_provider_subject;type:text" json:"provider"`
+	Subject   string    `gorm:"uniqueIndex:idx_identity_provider_subject;type:text" json:"-"`
+	Email     string    `gorm:"type:text" json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// OAuthState tracks an in-flight OpenID Connect login between the redirect to
+// the provider and the callback.
+type OAuthState struct {
+	State        string    `gorm:"primaryKey;type:text"`
+	Provider     string    `gorm:"type:text"`
+	CodeVerifier string    `gorm:"type:text"`
+	Nonce        string    `gorm:"type:text"`
+	ExpiresAt    time.Time `gorm:"index"`
+	CreatedAt    time.Time
+}
+
+// PersonalAccessToken lets scripts call the API on a user's behalf without a
+// password. Only the hash of the token is stored; Prefix is kept so users can
+// tell their tokens apart.
+type PersonalAccessToken struct {
+	ID         string     `gorm:"primaryKey;type:text" json:"id"`
+	UserID     string     `gorm:"index;type:text" json:"userId"`
+	Name       string     `gorm:"type:text" json:"name"`
+	Prefix     string     `gorm:"type:text" json:"prefix"`
+	TokenHash  string     `gorm:"uniqueIndex;type:text" json:"-"`
+	Scopes     []string   `gorm:"serializer:json;type:text" json:"scopes"`
+	ExpiresAt  time.Time  `gorm:"index" json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// WebAuthnCredential is a passkey or security key registered by a user.
+type WebAuthnCredential struct {
+	ID     string `gorm:"primaryKey;type:text" json:"id"`
+	UserID string `gorm:"index;type:text" json:"userId"`
+	// CredentialID is the authenticator's credential ID, base64url without padding.
+	CredentialID string `gorm:"uniqueIndex;type:text" json:"credentialId"`
+	// PublicKey is the COSE-encoded public key from registration.
+	PublicKey  []byte     `json:"-"`
+	SignCount  uint32     `gorm:"not null;default:0" json:"-"`
+	Name       string     `gorm:"type:text" json:"name"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// WebAuthnCeremony holds the challenge of an in-flight WebAuthn registration
+// or login until the browser answers it.
+type WebAuthnCeremony struct {
+	ID        string    `gorm:"primaryKey;type:text"`
+	UserID    string    `gorm:"index;type:text"`
+	Purpose   string    `gorm:"type:text"`
+	Challenge string    `gorm:"type:text"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// LoginAttempt counts recent failed logins for an account ("account:<email>")
+// or client IP ("ip:<addr>"). See the loginguard package.
+type LoginAttempt struct {
+	Key           string     `gorm:"primaryKey;type:text" json:"key"`
+	Failures      int        `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time  `gorm:"index" json:"lastFailureAt"`
+	LockedUntil   *time.Time `json:"lockedUntil,omitempty"`
+}
+
+// Impersonation is an audit record of a staff user acting as another user.
+// It backs a short-lived session owned by the target user.
+type Impersonation struct {
+	ID        string                 `gorm:"primaryKey;type:text" json:"id"`
+	AdminID   string                 `gorm:"index;type:text" json:"adminId"`
+	UserID    string                 `gorm:"index;type:text" json:"userId"`
+	SessionID string                 `gorm:"uniqueIndex;type:text" json:"sessionId"`
+	Reason    string                 `gorm:"type:text" json:"reason"`
+	IPAddress string                 `gorm:"type:text" json:"ipAddress"`
+	CreatedAt time.Time              `json:"createdAt"`
+	ExpiresAt time.Time              `json:"expiresAt"`
+	EndedAt   *time.Time             `json:"endedAt,omitempty"`
+	Requests  []ImpersonationRequest `gorm:"foreignKey:ImpersonationID;constraint:OnDelete:CASCADE;" json:"requests,omitempty"`
+}
+
+// ImpersonationRequest records one API request made while impersonating.
+type ImpersonationRequest struct {
+	ID              string    `gorm:"primaryKey;type:text" json:"id"`
+	ImpersonationID string    `gorm:"index;type:text" json:"impersonationId"`
+	Method          string    `gorm:"type:text" json:"method"`
+	Path            string    `gorm:"type:text" json:"path"`
+	Status          int       `json:"status"`
+	CreatedAt       time.Time `json:"createdAt"`
 }
 
 type AIRequestLog struct {
@@ -0,0 +1,144 @@
+package models
+
+import "encoding/json"
+
+// Named permissions for privileged (staff) operations. Routes declare the
+// permission they need with auth.RequirePermission.
+const (
+	PermSummaryRead      = "summary.read"
+	PermUsersRead        = "users.read"
+	PermUsersWrite       = "users.write"
+	PermUsersDelete      = "users.delete"
+	PermUsersImpersonate = "users.impersonate"
+	PermPlansRead        = "plans.read"
+	PermPlansWrite       = "plans.write"
+	PermPlansDelete      = "plans.delete"
+	PermExercisesManage  = "exercises.manage"
+	PermAIRequestsRead   = "ai_requests.read"
+	PermRolesManage      = "roles.manage"
+	PermAuditRead        = "audit.read"
+)
+
+// Permissions lists every permission with a short description.
+var Permissions = []struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}{
+	{PermSummaryRead, "View dashboard counts"},
+	{PermUsersRead, "View user accounts"},
+	{PermUsersWrite, "Create and edit user accounts"},
+	{PermUsersDelete, "Delete user accounts"},
+	{PermUsersImpersonate, "Act as a user to see what they see (read-only)"},
+	{PermPlansRead, "View any user's workout plans"},
+	{PermPlansWrite, "Create workout plans for users"},
+	{PermPlansDelete, "Delete any user's workout plans"},
+	{PermExercisesManage, "Manage global and user exercises"},
+	{PermAIRequestsRead, "View the AI request log"},
+	{PermRolesManage, "Create roles and assign them to users"},
+	{PermAuditRead, "View the impersonation audit log"},
+}
+
+// Built-in role names. Built-in roles are created on startup and can't be edited.
+const (
+	RoleAdmin         = "admin"
+	RoleSupport       = "support"
+	RoleContentEditor = "content_editor"
+)
+
+// BuiltinRoles are seeded into the roles table on every startup.
+var BuiltinRoles = []Role{
+	{
+		Name:        RoleAdmin,
+		Description: "Full access to the admin dashboard",
+		Permissions: rolePermissions(RoleAdmin, allPermissions()...),
+	},
+	{
+		Name:        RoleSupport,
+		Description: "Read-only access to users, plans and AI requests, and can impersonate users",
+		Permissions: rolePermissions(RoleSupport, PermSummaryRead, PermUsersRead, PermUsersImpersonate, PermPlansRead, PermAIRequestsRead),
+	},
+	{
+		Name:        RoleContentEditor,
+		Description: "Manages the global exercise library",
+		Permissions: rolePermissions(RoleContentEditor, PermSummaryRead, PermExercisesManage),
+	},
+}
+
+// IsPermission reports whether name is a known permission.
+func IsPermission(name string) bool {
+	for _, p := range Permissions {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func allPermissions() []string {
+	names := make([]string, len(Permissions))
+	for i, p := range Permissions {
+		names[i] = p.Name
+	}
+	return names
+}
+
+func rolePermissions(role string, perms ...string) []RolePermission {
+	out := make([]RolePermission, len(perms))
+	for i, p := range perms {
+		out[i] = RolePermission{RoleName: role, Permission: p}
+	}
+	return out
+}
+
+// RolePermissions are serialized as plain permission names.
+func (p RolePermission) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.Permission)
+}
+
+func (p *RolePermission) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &p.Permission)
+}
+
+// Scopes limit what a personal access token may do. Unlike permissions they
+// only ever cover the token owner's own data.
+const (
+	ScopePlansRead      = "plans:read"
+	ScopePlansWrite     = "plans:write"
+	ScopeProgramsRead   = "programs:read"
+	ScopeProgramsWrite  = "programs:write"
+	ScopeLogsRead       = "logs:read"
+	ScopeLogsWrite      = "logs:write"
+	ScopeExercisesRead  = "exercises:read"
+	ScopeExercisesWrite = "exercises:write"
+	ScopeProfileRead    = "profile:read"
+	ScopeProfileWrite   = "profile:write"
+	ScopeAI             = "ai"
+)
+
+// Scopes lists every token scope with a short description.
+var Scopes = []struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}{
+	{ScopePlansRead, "Read your workout plans"},
+	{ScopePlansWrite, "Create and delete workout plans"},
+	{ScopeProgramsRead, "Read your training programs"},
+	{ScopeProgramsWrite, "Create, change and follow training programs"},
+	{ScopeLogsRead, "Read your workout logs"},
+	{ScopeLogsWrite, "Record workouts"},
+	{ScopeExercisesRead, "Read the exercise library"},
+	{ScopeExercisesWrite, "Create and delete your own exercises"},
+	{ScopeProfileRead, "Read your profile"},
+	{ScopeProfileWrite, "Update your profile"},
+	{ScopeAI, "Generate plans and reports with AI"},
+}
+
+// IsScope reports whether name is a known token scope.
+func IsScope(name string) bool {
+	for _, s := range Scopes {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
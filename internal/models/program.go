@@ -0,0 +1,96 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// Program is a multi-week training block, e.g. a 4-day split run for 8-12
+// weeks. Each week lists named days that point at one of the user's plans,
+// and the progression rules say how targets grow from week to week.
+type Program struct {
+	ID          string    `gorm:"primaryKey;type:text" json:"id"`
+	UserID      string    `gorm:"index;type:text" json:"userId"`
+	Name        string    `gorm:"type:text" json:"name"`
+	Description string    `gorm:"type:text" json:"description"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+
+	// WeightIncrement is added to working weights for every completed
+	// non-deload week (in the user's weight unit).
+	WeightIncrement float64 `json:"weightIncrement"`
+	// RepIncrement is added to target reps for every completed non-deload week.
+	RepIncrement int `json:"repIncrement"`
+	// DeloadPercent scales sets and weights on deload weeks.
+	DeloadPercent int `gorm:"not null;default:60" json:"deloadPercent"`
+
+	Weeks []ProgramWeek `gorm:"foreignKey:ProgramID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"weeks"`
+}
+
+type ProgramWeek struct {
+	ID        uint   `gorm:"primaryKey" json:"-"`
+	ProgramID string `gorm:"index;type:text" json:"-"`
+	Number    int    `json:"number"` // From 1
+	Deload    bool   `json:"deload"`
+
+	Days []ProgramDay `gorm:"foreignKey:WeekID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"days"`
+}
+
+type ProgramDay struct {
+	ID       uint   `gorm:"primaryKey" json:"-"`
+	WeekID   uint   `gorm:"index" json:"-"`
+	Position int    `json:"position"` // Order within the week, from 0
+	Name     string `gorm:"type:text" json:"name"`
+	PlanID   string `gorm:"index;type:text" json:"planId"`
+}
+
+// ProgramProgress is the user's place in the program they are following.
+// A user follows at most one program at a time.
+type ProgramProgress struct {
+	UserID      string     `gorm:"primaryKey;type:text" json:"userId"`
+	ProgramID   string     `gorm:"index;type:text" json:"programId"`
+	Week        int        `json:"week"` // ProgramWeek.Number
+	Day         int        `json:"day"`  // ProgramDay.Position
+	StartedAt   time.Time  `json:"startedAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+// ExerciseTarget is a plan exercise with the program's progression applied
+// for a given week.
+type ExerciseTarget struct {
+	PlanExercise
+	TargetSets int `json:"targetSets"`
+	TargetReps int `json:"targetReps"`
+	// WeightIncrease is added to the exercise's working weight, then the
+	// result is multiplied by WeightFactor (below 1 on deload weeks).
+	WeightIncrease float64 `json:"weightIncrease"`
+	WeightFactor   float64 `json:"weightFactor"`
+}
+
+// Targets applies the progression for the given week number to a plan exercise.
+func (p *Program) Targets(week int, exercise PlanExercise) ExerciseTarget {
+	steps, deload := 0, false
+	for _, w := range p.Weeks {
+		if w.Number < week && !w.Deload {
+			steps++
+		}
+		if w.Number == week {
+			deload = w.Deload
+		}
+	}
+
+	target := ExerciseTarget{
+		PlanExercise:   exercise,
+		TargetSets:     exercise.DefaultSets,
+		TargetReps:     exercise.DefaultReps + steps*p.RepIncrement,
+		WeightIncrease: float64(steps) * p.WeightIncrement,
+		WeightFactor:   1,
+	}
+	if deload {
+		factor := float64(p.DeloadPercent) / 100
+		target.TargetSets = max(1, int(math.Round(float64(exercise.DefaultSets)*factor)))
+		target.WeightFactor = factor
+	}
+	return target
+}
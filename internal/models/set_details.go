@@ -0,0 +1,102 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+)
+
+// Set types. Only working sets are used for progression, e.g. when a new
+// workout is pre-filled from the last one.
+const (
+	SetTypeWarmup  = "warmup"
+	SetTypeWorking = "working"
+	SetTypeDrop    = "drop"
+	SetTypeFailure = "failure"
+)
+
+const maxSetNotes = 500
+
+// Tempo is written as four phases (eccentric, bottom pause, concentric, top
+// pause) in seconds, with X for explosive, e.g. "31X0" or "3-1-X-0".
+var tempoPattern = regexp.MustCompile(`^[0-9Xx](-?[0-9Xx]){3}$`)
+
+// SetDetails is what a lifter records about a set besides weight and reps.
+// RPE (rate of perceived exertion) and RIR (reps in reserve) are two ways of
+// saying how hard it was; either or both can be given.
+type SetDetails struct {
+	SetType     string   `gorm:"type:text;not null;default:working" json:"setType"`
+	RPE         *float64 `json:"rpe,omitempty"`         // 1-10 in steps of 0.5
+	RIR         *int     `json:"rir,omitempty"`         // 0-10
+	RestSeconds *int     `json:"restSeconds,omitempty"` // Rest actually taken before the set
+	Tempo       string   `gorm:"type:text" json:"tempo,omitempty"`
+	Notes       string   `gorm:"type:text" json:"notes,omitempty"`
+}
+
+// Validate checks the ranges and fills in the default set type.
+func (d *SetDetails) Validate() error {
+	switch d.SetType {
+	case "":
+		d.SetType = SetTypeWorking
+	case SetTypeWarmup, SetTypeWorking, SetTypeDrop, SetTypeFailure:
+	default:
+		return fmt.Errorf("setType must be warmup, working, drop or failure")
+	}
+	if err := validateEffort(d.RPE, d.RIR, "rpe", "rir"); err != nil {
+		return err
+	}
+	if d.RestSeconds != nil && (*d.RestSeconds < 0 || *d.RestSeconds > 3600) {
+		return fmt.Errorf("restSeconds must be between 0 and 3600")
+	}
+	if err := validateTempo(d.Tempo); err != nil {
+		return err
+	}
+	if len(d.Notes) > maxSetNotes {
+		return fmt.Errorf("notes can't be longer than %d characters", maxSetNotes)
+	}
+	return nil
+}
+
+// ExerciseTargets is how a plan wants an exercise performed, on top of its
+// default sets and reps.
+type ExerciseTargets struct {
+	TargetRPE  *float64 `json:"targetRpe,omitempty"`
+	TargetRIR  *int     `json:"targetRir,omitempty"`
+	Tempo      string   `gorm:"type:text" json:"tempo,omitempty"`
+	WarmupSets int      `gorm:"not null;default:0" json:"warmupSets,omitempty"`
+	Notes      string   `gorm:"type:text" json:"notes,omitempty"`
+}
+
+// Validate checks the ranges of the targets.
+func (t *ExerciseTargets) Validate() error {
+	if err := validateEffort(t.TargetRPE, t.TargetRIR, "targetRpe", "targetRir"); err != nil {
+		return err
+	}
+	if err := validateTempo(t.Tempo); err != nil {
+		return err
+	}
+	if t.WarmupSets < 0 || t.WarmupSets > 10 {
+		return fmt.Errorf("warmupSets must be between 0 and 10")
+	}
+	if len(t.Notes) > maxSetNotes {
+		return fmt.Errorf("notes can't be longer than %d characters", maxSetNotes)
+	}
+	return nil
+}
+
+func validateEffort(rpe *float64, rir *int, rpeField, rirField string) error {
+	if rpe != nil && (*rpe < 1 || *rpe > 10 || math.Mod(*rpe*2, 1) != 0) {
+		return fmt.Errorf("%s must be between 1 and 10 in steps of 0.5", rpeField)
+	}
+	if rir != nil && (*rir < 0 || *rir > 10) {
+		return fmt.Errorf("%s must be between 0 and 10", rirField)
+	}
+	return nil
+}
+
+func validateTempo(tempo string) error {
+	if tempo != "" && !tempoPattern.MatchString(tempo) {
+		return fmt.Errorf("tempo must be four phases like 31X0 or 3-1-X-0")
+	}
+	return nil
+}
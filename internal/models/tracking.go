@@ -0,0 +1,91 @@
+package models
+
+import "fmt"
+
+// Tracking types say what is recorded for each set of an exercise.
+const (
+	TrackingWeightReps       = "weight_reps"       // Barbell, dumbbell, machine lifts
+	TrackingBodyweightReps   = "bodyweight_reps"   // Pull-ups, push-ups; weight is added load
+	TrackingDuration         = "duration"          // Planks, holds
+	TrackingDistanceDuration = "distance_duration" // Runs, rows, rides
+	TrackingWeightedDistance = "weighted_distance" // Carries, sled pushes
+)
+
+// ValidTrackingType reports whether t is one of the tracking types.
+func ValidTrackingType(t string) bool {
+	switch t {
+	case TrackingWeightReps, TrackingBodyweightReps, TrackingDuration, TrackingDistanceDuration, TrackingWeightedDistance:
+		return true
+	}
+	return false
+}
+
+// ValidateSetFields checks a set against its exercise's tracking type. Fields
+// that don't apply must be left empty, and a completed set must have the ones
+// that do. Incomplete sets may still be blank, e.g. in a draft. An empty
+// tracking type means weight and reps.
+func ValidateSetFields(trackingType string, set LogSet) error {
+	if trackingType == "" {
+		trackingType = TrackingWeightReps
+	}
+	if set.Weight < 0 || set.Reps < 0 || set.DurationSeconds < 0 || set.DistanceMeters < 0 {
+		return fmt.Errorf("can't have negative values")
+	}
+
+	var usesWeight, usesReps, usesDuration, usesDistance bool
+	var required []string
+	switch trackingType {
+	case TrackingWeightReps:
+		usesWeight, usesReps = true, true
+		required = []string{"reps"}
+	case TrackingBodyweightReps:
+		usesWeight, usesReps = true, true
+		required = []string{"reps"}
+	case TrackingDuration:
+		usesWeight, usesDuration = true, true
+		required = []string{"durationSeconds"}
+	case TrackingDistanceDuration:
+		usesDuration, usesDistance = true, true
+		required = []string{"distanceMeters", "durationSeconds"}
+	case TrackingWeightedDistance:
+		usesWeight, usesDistance, usesDuration = true, true, true
+		required = []string{"weight", "distanceMeters"}
+	default:
+		return fmt.Errorf("unknown tracking type %q", trackingType)
+	}
+
+	switch {
+	case !usesWeight && set.Weight != 0:
+		return fmt.Errorf("weight isn't recorded for %s exercises", trackingType)
+	case !usesReps && set.Reps != 0:
+		return fmt.Errorf("reps aren't recorded for %s exercises", trackingType)
+	case !usesDuration && set.DurationSeconds != 0:
+		return fmt.Errorf("durationSeconds isn't recorded for %s exercises", trackingType)
+	case !usesDistance && set.DistanceMeters != 0:
+		return fmt.Errorf("distanceMeters isn't recorded for %s exercises", trackingType)
+	}
+
+	if !set.Completed {
+		return nil
+	}
+	values := map[string]float64{
+		"weight":          set.Weight,
+		"reps":            float64(set.Reps),
+		"durationSeconds": float64(set.DurationSeconds),
+		"distanceMeters":  set.DistanceMeters,
+	}
+	for _, field := range required {
+		if values[field] == 0 {
+			return fmt.Errorf("a completed %s set needs %s", trackingType, field)
+		}
+	}
+	return nil
+}
+
+// PaceSecondsPerKm is the time taken per kilometre, or 0 without a distance.
+func PaceSecondsPerKm(distanceMeters float64, durationSeconds int) float64 {
+	if distanceMeters <= 0 {
+		return 0
+	}
+	return float64(durationSeconds) / (distanceMeters / 1000)
+}
@@ -3,6 +3,7 @@ package router
 import (
 	"irontrack-backend/internal/auth"
 	"irontrack-backend/internal/handlers"
+	"irontrack-backend/internal/models"
 	"net/http"
 	"os"
 	"strings"
@@ -40,6 +41,7 @@ func SetupRouter(gitCommit, buildTime string) *gin.Engine {
 	}
 
 	config.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
+	config.ExposeHeaders = []string{"X-Next-Cursor"}
 	config.AllowCredentials = true
 	r.Use(cors.New(config))
 	r.Use(DevelopmentLogger())
@@ -54,67 +56,178 @@ func SetupRouter(gitCommit, buildTime string) *gin.Engine {
 		})
 	})
 
+	// Public keys for verifying our access tokens
+	r.GET("/.well-known/jwks.json", handlers.JWKS)
+
 	// Routes
 	api := r.Group("/api")
 	{
 		api.POST("/register", handlers.Register)
 		api.POST("/login", handlers.Login)
+		api.POST("/login/2fa", handlers.VerifyLoginChallenge)
+		api.POST("/login/magic-link", handlers.RequestMagicLink)
+		api.POST("/login/magic-link/verify", handlers.MagicLinkLogin)
+		api.POST("/login/passkey/begin", handlers.BeginPasskeyLogin)
+		api.POST("/login/passkey/finish", handlers.FinishPasskeyLogin)
+		api.POST("/login/2fa/webauthn", handlers.BeginWebAuthnSecondFactor)
+		api.POST("/token/refresh", handlers.RefreshToken)
+		api.POST("/password/forgot", handlers.ForgotPassword)
+		api.POST("/password/reset", handlers.ResetPassword)
+		api.POST("/email/verify", handlers.VerifyEmail)
+
+		// Social login (OpenID Connect), see OIDC_PROVIDERS
+		api.GET("/oauth/:provider/start", handlers.StartOIDCLogin)
+		api.POST("/oauth/:provider/callback", handlers.OIDCCallback)
 
 		protected := api.Group("/")
 		protected.Use(auth.AuthMiddleware())
 		{
 			protected.GET("/me", handlers.GetMe)
 
+			// Account management is only possible from a login session, not
+			// with a personal access token
+			account := protected.Group("/")
+			account.Use(auth.RequireSession())
+			account.POST("/logout", handlers.Logout)
+			account.POST("/email/verify/resend", handlers.ResendVerificationEmail)
+			account.POST("/password/change", handlers.ChangePassword)
+
+			// Data export and closing the account
+			account.GET("/account/export", handlers.ExportAccount)
+			account.POST("/account/deletion", handlers.RequestAccountDeletion)
+			account.DELETE("/account/deletion", handlers.CancelAccountDeletion)
+
+			// Sessions (logged-in devices)
+			account.GET("/sessions", handlers.ListSessions)
+			account.DELETE("/sessions", handlers.RevokeOtherSessions)
+			account.DELETE("/sessions/:id", handlers.RevokeSession)
+
+			// Two-factor authentication
+			account.GET("/2fa", handlers.GetTwoFactorStatus)
+			account.POST("/2fa/totp/setup", handlers.SetupTOTP)
+			account.POST("/2fa/totp/enable", handlers.EnableTOTP)
+			account.POST("/2fa/totp/disable", handlers.DisableTOTP)
+			account.POST("/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
+
+			// Passkeys and security keys (WebAuthn)
+			account.GET("/webauthn/credentials", handlers.ListWebAuthnCredentials)
+			account.POST("/webauthn/register/begin", handlers.BeginWebAuthnRegistration)
+			account.POST("/webauthn/register/finish", handlers.FinishWebAuthnRegistration)
+			account.DELETE("/webauthn/credentials/:id", handlers.DeleteWebAuthnCredential)
+
+			// Personal access tokens
+			account.GET("/tokens", handlers.ListAccessTokens)
+			account.GET("/tokens/scopes", handlers.ListAccessTokenScopes)
+			account.POST("/tokens", handlers.CreateAccessToken)
+			account.DELETE("/tokens/:id", handlers.RevokeAccessToken)
+
+			// Everything below may require a verified email, see EMAIL_VERIFICATION_POLICY
+			data := protected.Group("/")
+			data.Use(auth.RequireVerifiedEmail(auth.VerificationScopeAll))
+
 			// Plans
-			protected.GET("/plans", handlers.GetPlans)
-			protected.POST("/plans", handlers.CreatePlan)
-			protected.DELETE("/plans/:id", handlers.DeletePlan)
+			data.GET("/plans", auth.RequireScope(models.ScopePlansRead), handlers.GetPlans)
+			data.GET("/plans/:id", auth.RequireScope(models.ScopePlansRead), handlers.GetPlan)
+			data.POST("/plans", auth.RequireScope(models.ScopePlansWrite), handlers.CreatePlan)
+			data.PUT("/plans/:id", auth.RequireScope(models.ScopePlansWrite), handlers.ReplacePlan)
+			data.PATCH("/plans/:id", auth.RequireScope(models.ScopePlansWrite), handlers.PatchPlan)
+			data.DELETE("/plans/:id", auth.RequireScope(models.ScopePlansWrite), handlers.DeletePlan)
+			data.POST("/plans/:id/start", auth.RequireScope(models.ScopePlansRead), auth.RequireScope(models.ScopeLogsWrite), handlers.StartWorkoutFromPlan)
 
 			// Logs
-			protected.GET("/logs", handlers.GetLogs)
-			protected.POST("/logs", handlers.CreateLog)
+			data.GET("/logs", auth.RequireScope(models.ScopeLogsRead), handlers.GetLogs)
+			data.GET("/logs/:id", auth.RequireScope(models.ScopeLogsRead), handlers.GetLog)
+			data.POST("/logs", auth.RequireScope(models.ScopeLogsWrite), handlers.CreateLog)
+			data.PUT("/logs/:id", auth.RequireScope(models.ScopeLogsWrite), handlers.ReplaceLog)
+			data.PATCH("/logs/:id", auth.RequireScope(models.ScopeLogsWrite), handlers.PatchLog)
+			data.DELETE("/logs/:id", auth.RequireScope(models.ScopeLogsWrite), handlers.DeleteLog)
+			data.GET("/stats/exercises", auth.RequireScope(models.ScopeLogsRead), handlers.GetExerciseStats)
+
+			// Live workout sessions
+			data.POST("/workouts", auth.RequireScope(models.ScopeLogsWrite), handlers.StartWorkout)
+			data.GET("/workouts/current", auth.RequireScope(models.ScopeLogsRead), handlers.GetCurrentWorkout)
+			data.DELETE("/workouts/current", auth.RequireScope(models.ScopeLogsWrite), handlers.DiscardWorkout)
+			data.POST("/workouts/current/pause", auth.RequireScope(models.ScopeLogsWrite), handlers.PauseWorkout)
+			data.POST("/workouts/current/resume", auth.RequireScope(models.ScopeLogsWrite), handlers.ResumeWorkout)
+			data.POST("/workouts/current/finish", auth.RequireScope(models.ScopeLogsWrite), handlers.FinishWorkout)
+			data.POST("/workouts/current/exercises", auth.RequireScope(models.ScopeLogsWrite), handlers.AddWorkoutExercise)
+			data.DELETE("/workouts/current/exercises/:exerciseId", auth.RequireScope(models.ScopeLogsWrite), handlers.RemoveWorkoutExercise)
+			data.POST("/workouts/current/exercises/:exerciseId/sets", auth.RequireScope(models.ScopeLogsWrite), handlers.AddWorkoutSet)
+			data.PATCH("/workouts/current/sets/:setId", auth.RequireScope(models.ScopeLogsWrite), handlers.UpdateWorkoutSet)
+			data.DELETE("/workouts/current/sets/:setId", auth.RequireScope(models.ScopeLogsWrite), handlers.DeleteWorkoutSet)
+
+			// Programs
+			data.GET("/programs", auth.RequireScope(models.ScopeProgramsRead), handlers.GetPrograms)
+			data.GET("/programs/current", auth.RequireScope(models.ScopeProgramsRead), handlers.GetCurrentProgramDay)
+			data.PUT("/programs/current", auth.RequireScope(models.ScopeProgramsWrite), handlers.SetCurrentProgram)
+			data.POST("/programs/current/advance", auth.RequireScope(models.ScopeProgramsWrite), handlers.AdvanceProgram)
+			data.DELETE("/programs/current", auth.RequireScope(models.ScopeProgramsWrite), handlers.StopProgram)
+			data.GET("/programs/:id", auth.RequireScope(models.ScopeProgramsRead), handlers.GetProgram)
+			data.POST("/programs", auth.RequireScope(models.ScopeProgramsWrite), handlers.CreateProgram)
+			data.PUT("/programs/:id", auth.RequireScope(models.ScopeProgramsWrite), handlers.UpdateProgram)
+			data.DELETE("/programs/:id", auth.RequireScope(models.ScopeProgramsWrite), handlers.DeleteProgram)
 
 			// Exercises
-			protected.GET("/exercises", handlers.GetExercises)
-			protected.POST("/exercises", handlers.CreateExercise)
-			protected.DELETE("/exercises/:id", handlers.DeleteExercise)
+			data.GET("/exercises", auth.RequireScope(models.ScopeExercisesRead), handlers.GetExercises)
+			data.POST("/exercises", auth.RequireScope(models.ScopeExercisesWrite), handlers.CreateExercise)
+			data.DELETE("/exercises/:id", auth.RequireScope(models.ScopeExercisesWrite), handlers.DeleteExercise)
 
 			// Profile
-			protected.GET("/profile", handlers.GetProfile)
-			protected.POST("/profile", handlers.SaveProfile)
+			data.GET("/profile", auth.RequireScope(models.ScopeProfileRead), handlers.GetProfile)
+			data.POST("/profile", auth.RequireScope(models.ScopeProfileWrite), handlers.SaveProfile)
 
 			// AI
-			protected.POST("/ai/generate-plan", handlers.GenerateWorkoutPlan)
-			protected.POST("/ai/generate-report", handlers.GenerateProgressReport)
+			ai := data.Group("/ai")
+			ai.Use(auth.RequireVerifiedEmail(auth.VerificationScopeAI), auth.RequireScope(models.ScopeAI))
+			ai.POST("/generate-plan", handlers.GenerateWorkoutPlan)
+			ai.POST("/generate-report", handlers.GenerateProgressReport)
 		}
 
-		// Admin-only routes
+		// Admin routes, each guarded by the permission it needs
 		admin := api.Group("/admin")
-		admin.Use(auth.AuthMiddleware())
-		admin.Use(auth.AdminMiddleware())
+		admin.Use(auth.AuthMiddleware(), auth.RequireSession())
 		{
-			admin.GET("/summary", handlers.AdminSummary)
+			admin.GET("/summary", auth.RequirePermission(models.PermSummaryRead), handlers.AdminSummary)
 
 			// Users
-			admin.GET("/users", handlers.AdminListUsers)
-			admin.POST("/users", handlers.AdminCreateUser)
-			admin.PUT("/users/:id", handlers.AdminUpdateUser)
-			admin.DELETE("/users/:id", handlers.AdminDeleteUser)
+			admin.GET("/users", auth.RequirePermission(models.PermUsersRead), handlers.AdminListUsers)
+			admin.POST("/users", auth.RequirePermission(models.PermUsersWrite), handlers.AdminCreateUser)
+			admin.PUT("/users/:id", auth.RequirePermission(models.PermUsersWrite), handlers.AdminUpdateUser)
+			admin.DELETE("/users/:id", auth.RequirePermission(models.PermUsersDelete), handlers.AdminDeleteUser)
+			admin.PUT("/users/:id/roles", auth.RequirePermission(models.PermRolesManage), handlers.AdminSetUserRoles)
+
+			// Impersonation and its audit log
+			admin.POST("/users/:id/impersonate", auth.RequirePermission(models.PermUsersImpersonate), handlers.AdminStartImpersonation)
+			admin.DELETE("/impersonations/:id", auth.RequirePermission(models.PermUsersImpersonate), handlers.AdminEndImpersonation)
+			admin.GET("/impersonations", auth.RequirePermission(models.PermAuditRead), handlers.AdminListImpersonations)
+			admin.GET("/impersonations/:id", auth.RequirePermission(models.PermAuditRead), handlers.AdminGetImpersonation)
+
+			// Failed logins and lockouts
+			admin.GET("/login-attempts", auth.RequirePermission(models.PermUsersRead), handlers.AdminListLoginAttempts)
+			admin.DELETE("/login-attempts", auth.RequirePermission(models.PermUsersWrite), handlers.AdminUnlockLogin)
+
+			// Roles and permissions
+			admin.GET("/permissions", auth.RequirePermission(models.PermRolesManage), handlers.AdminListPermissions)
+			admin.GET("/roles", auth.RequirePermission(models.PermRolesManage), handlers.AdminListRoles)
+			admin.POST("/roles", auth.RequirePermission(models.PermRolesManage), handlers.AdminCreateRole)
+			admin.PUT("/roles/:name", auth.RequirePermission(models.PermRolesManage), handlers.AdminUpdateRole)
+			admin.DELETE("/roles/:name", auth.RequirePermission(models.PermRolesManage), handlers.AdminDeleteRole)
 
 			// Plans
-			admin.GET("/plans", handlers.AdminListPlans)
-			admin.POST("/plans", handlers.AdminCreatePlan)
-			admin.DELETE("/plans/:id", handlers.AdminDeletePlan)
+			admin.GET("/plans", auth.RequirePermission(models.PermPlansRead), handlers.AdminListPlans)
+			admin.POST("/plans", auth.RequirePermission(models.PermPlansWrite), handlers.AdminCreatePlan)
+			admin.DELETE("/plans/:id", auth.RequirePermission(models.PermPlansDelete), handlers.AdminDeletePlan)
 
 			// Exercises
-			admin.GET("/exercises", handlers.AdminListExercises)
-			admin.POST("/exercises", handlers.AdminCreateExercise)
-			admin.DELETE("/exercises/:id", handlers.AdminDeleteExercise)
+			exercises := admin.Group("/exercises")
+			exercises.Use(auth.RequirePermission(models.PermExercisesManage))
+			exercises.GET("", handlers.AdminListExercises)
+			exercises.POST("", handlers.AdminCreateExercise)
+			exercises.DELETE("/:id", handlers.AdminDeleteExercise)
+			exercises.POST("/bulk", handlers.BulkUploadExercises)
 
 			// AI Requests log
-			admin.GET("/ai-requests", handlers.AdminListAIRequests)
-
-			admin.POST("/exercises/bulk", handlers.BulkUploadExercises)
+			admin.GET("/ai-requests", auth.RequirePermission(models.PermAIRequestsRead), handlers.AdminListAIRequests)
 		}
 	}
 	return r
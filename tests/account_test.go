@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"irontrack-backend/internal/account"
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountExportAndDeletion(t *testing.T) {
+	r := setupTestRouter()
+	session := registerUser(t, r, "leaving@example.com")
+	userID := session.User.ID
+
+	doJSON(r, "POST", "/api/plans", session.Token, map[string]interface{}{
+		"id": "leaving-plan", "name": "Legs", "exercises": []map[string]interface{}{{"name": "Squat", "defaultSets": 5, "defaultReps": 5}},
+	})
+	doJSON(r, "POST", "/api/logs", session.Token, map[string]interface{}{
+		"id": "leaving-log", "date": time.Now(), "exercises": []map[string]interface{}{
+			{"id": "leaving-log-ex", "name": "Squat", "sets": []map[string]interface{}{{"id": "leaving-set", "weight": 100, "reps": 5, "completed": true}}},
+		},
+	})
+	doJSON(r, "POST", "/api/profile", session.Token, map[string]string{"mainGoal": "strength"})
+
+	// 1. Export contains everything
+	w := doJSON(r, "GET", "/api/account/export", session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+	var export account.Export
+	json.Unmarshal(w.Body.Bytes(), &export)
+	assert.Equal(t, "leaving@example.com", export.Account.Email)
+	assert.Equal(t, "strength", export.Profile.MainGoal)
+	assert.Len(t, export.Plans, 1)
+	if assert.Len(t, export.Logs, 1) {
+		assert.Len(t, export.Logs[0].Exercises[0].Sets, 1)
+	}
+	assert.NotContains(t, w.Body.String(), "refreshTokenHash")
+
+	// 2. Deletion needs the password and can be cancelled
+	w = doJSON(r, "POST", "/api/account/deletion", session.Token, map[string]string{"password": "wrong"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = doJSON(r, "POST", "/api/account/deletion", session.Token, map[string]string{"password": "correct-horse-42"})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	msg, _ := testMailer.LastTo("leaving@example.com")
+	assert.Equal(t, "Your IronTrack account will be deleted", msg.Subject)
+
+	w = doJSON(r, "DELETE", "/api/account/deletion", session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(r, "DELETE", "/api/account/deletion", session.Token, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 3. Nothing happens before the grace period ends
+	w = doJSON(r, "POST", "/api/account/deletion", session.Token, map[string]string{"password": "correct-horse-42"})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	_, err := account.PurgeDue(time.Now())
+	assert.NoError(t, err)
+	var count int64
+	database.DB.Model(&models.User{}).Where("id = ?", userID).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// 4. Afterwards every row is gone, except the staff audit trail and
+	// accounts that were only soft-deleted by an admin
+	assert.NoError(t, database.DB.Create(&models.Impersonation{
+		ID: "leaving-impersonation", AdminID: "some-admin", UserID: userID, SessionID: "leaving-imp-session", Reason: "Ticket #7",
+	}).Error)
+	disabled := registerUser(t, r, "disabled@example.com")
+	database.DB.Where("id = ?", disabled.User.ID).Delete(&models.User{})
+
+	_, err = account.PurgeDue(time.Now().Add(account.DeletionGrace + time.Minute))
+	assert.NoError(t, err)
+	for _, model := range []interface{}{&models.WorkoutPlan{}, &models.WorkoutLog{}, &models.UserProfile{}, &models.Session{}} {
+		database.DB.Model(model).Where("user_id = ?", userID).Count(&count)
+		assert.Zero(t, count)
+	}
+	database.DB.Model(&models.PlanExercise{}).Where("plan_id = ?", "leaving-plan").Count(&count)
+	assert.Zero(t, count)
+	database.DB.Model(&models.LogSet{}).Where("id = ?", "leaving-set").Count(&count)
+	assert.Zero(t, count)
+	database.DB.Unscoped().Model(&models.User{}).Where("id = ?", userID).Count(&count)
+	assert.Zero(t, count)
+	database.DB.Model(&models.Impersonation{}).Where("id = ?", "leaving-impersonation").Count(&count)
+	assert.Equal(t, int64(1), count)
+	database.DB.Unscoped().Model(&models.User{}).Where("id = ?", disabled.User.ID).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	w = doJSON(r, "GET", "/api/me", session.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
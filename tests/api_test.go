@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/mail"
 	"irontrack-backend/internal/models"
 	"irontrack-backend/internal/router"
 
@@ -16,10 +17,15 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// testMailer captures every email the API sends during the test run.
+var testMailer = mail.NewMemoryMailer()
+
 func TestMain(m *testing.M) {
 	// Set Gin to Test Mode
 	gin.SetMode(gin.TestMode)
 
+	mail.SetDefault(testMailer)
+
 	// Setup In-Memory Database
 	database.ConnectDatabase("file::memory:?cache=shared")
 
@@ -41,7 +47,7 @@ func TestRegisterAndLogin(t *testing.T) {
 	registerPayload := map[string]string{
 		"name":     "Test User",
 		"email":    "test@example.com",
-		"password": "password123",
+		"password": "correct-horse-42",
 	}
 	jsonValue, _ := json.Marshal(registerPayload)
 	req, _ := http.NewRequest("POST", "/api/register", bytes.NewBuffer(jsonValue))
@@ -54,7 +60,7 @@ func TestRegisterAndLogin(t *testing.T) {
 	w = httptest.NewRecorder()
 	loginPayload := map[string]string{
 		"email":    "test@example.com",
-		"password": "password123",
+		"password": "correct-horse-42",
 	}
 	jsonValue, _ = json.Marshal(loginPayload)
 	req, _ = http.NewRequest("POST", "/api/login", bytes.NewBuffer(jsonValue))
@@ -84,7 +90,7 @@ func TestPlansCRUD(t *testing.T) {
 	registerPayload := map[string]string{
 		"name":     "Plan Tester",
 		"email":    "plan_test@example.com",
-		"password": "password123",
+		"password": "correct-horse-42",
 	}
 	jsonBytes, _ := json.Marshal(registerPayload)
 	req, _ := http.NewRequest("POST", "/api/register", bytes.NewBuffer(jsonBytes))
@@ -0,0 +1,220 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"irontrack-backend/internal/auth"
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/handlers"
+	"irontrack-backend/internal/mail"
+	"irontrack-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// doJSON sends a JSON request with an optional bearer token and returns the recorder.
+func doJSON(r *gin.Engine, method, path, token string, payload interface{}) *httptest.ResponseRecorder {
+	var body *bytes.Buffer
+	if payload != nil {
+		jsonBytes, _ := json.Marshal(payload)
+		body = bytes.NewBuffer(jsonBytes)
+	} else {
+		body = bytes.NewBuffer(nil)
+	}
+	req, _ := http.NewRequest(method, path, body)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// registerUser creates an account through the API and returns the auth response.
+func registerUser(t *testing.T, r *gin.Engine, email string) handlers.AuthResponse {
+	w := doJSON(r, "POST", "/api/register", "", map[string]string{
+		"name":     "Test User",
+		"email":    email,
+		"password": "correct-horse-42",
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var resp handlers.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp
+}
+
+func TestRefreshTokenRotationAndLogout(t *testing.T) {
+	r := setupTestRouter()
+	session := registerUser(t, r, "refresh@example.com")
+	assert.NotEmpty(t, session.RefreshToken)
+
+	// 1. Refresh rotates the refresh token
+	w := doJSON(r, "POST", "/api/token/refresh", "", map[string]string{"refreshToken": session.RefreshToken})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var refreshed handlers.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &refreshed)
+	assert.NotEmpty(t, refreshed.Token)
+	assert.NotEqual(t, session.RefreshToken, refreshed.RefreshToken)
+
+	// 2. Replaying the old refresh token is rejected and kills the session
+	w = doJSON(r, "POST", "/api/token/refresh", "", map[string]string{"refreshToken": session.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = doJSON(r, "POST", "/api/token/refresh", "", map[string]string{"refreshToken": refreshed.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// 3. Logout revokes a fresh session
+	w = doJSON(r, "POST", "/api/login", "", map[string]string{"email": "refresh@example.com", "password": "correct-horse-42"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var login handlers.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &login)
+
+	w = doJSON(r, "POST", "/api/logout", login.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doJSON(r, "POST", "/api/token/refresh", "", map[string]string{"refreshToken": login.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestSessionManagement(t *testing.T) {
+	r := setupTestRouter()
+	phone := registerUser(t, r, "devices@example.com")
+
+	w := doJSON(r, "POST", "/api/login", "", map[string]string{
+		"email":      "devices@example.com",
+		"password":   "correct-horse-42",
+		"deviceName": "Web",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var web handlers.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &web)
+
+	// 1. Both devices are listed, and the caller's is flagged as current
+	w = doJSON(r, "GET", "/api/sessions", web.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var sessions []handlers.SessionResponse
+	json.Unmarshal(w.Body.Bytes(), &sessions)
+	assert.Len(t, sessions, 2)
+	for _, s := range sessions {
+		assert.Equal(t, s.DeviceName == "Web", s.Current)
+	}
+
+	// 2. Revoking the others locks out the phone immediately
+	w = doJSON(r, "DELETE", "/api/sessions", web.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doJSON(r, "GET", "/api/me", phone.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = doJSON(r, "GET", "/api/me", web.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// tokenFromMail extracts the ?token= value from the last link mailed to the address.
+func tokenFromMail(t *testing.T, to string) string {
+	msg, ok := testMailer.LastTo(to)
+	if !assert.True(t, ok, "expected an email to %s", to) {
+		return ""
+	}
+	return tokenFromMessage(msg)
+}
+
+// waitForMail waits for an email that is sent after the response, e.g. a
+// password reset, and returns it.
+func waitForMail(t *testing.T, to, subject string) (mail.Message, bool) {
+	var found mail.Message
+	ok := assert.Eventually(t, func() bool {
+		for _, msg := range testMailer.Sent() {
+			if msg.To == to && msg.Subject == subject {
+				found = msg
+				return true
+			}
+		}
+		return false
+	}, 2*time.Second, 10*time.Millisecond, "expected a %q email to %s", subject, to)
+	return found, ok
+}
+
+func tokenFromMessage(msg mail.Message) string {
+	_, rest, _ := strings.Cut(msg.Body, "?token=")
+	token, _, _ := strings.Cut(rest, "\n")
+	token, _ = url.QueryUnescape(token)
+	return token
+}
+
+func TestPasswordReset(t *testing.T) {
+	r := setupTestRouter()
+	session := registerUser(t, r, "forgetful@example.com")
+
+	// Unknown emails get the same answer and no mail
+	w := doJSON(r, "POST", "/api/password/forgot", "", map[string]string{"email": "nobody@example.com"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, sent := testMailer.LastTo("nobody@example.com")
+	assert.False(t, sent)
+
+	w = doJSON(r, "POST", "/api/password/forgot", "", map[string]string{"email": "forgetful@example.com"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	msg, _ := waitForMail(t, "forgetful@example.com", "Reset your IronTrack password")
+	token := tokenFromMessage(msg)
+	assert.NotEmpty(t, token)
+
+	// Asking again straight away doesn't send another
+	w = doJSON(r, "POST", "/api/password/forgot", "", map[string]string{"email": "forgetful@example.com"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Never(t, func() bool {
+		var count int64
+		database.DB.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ?", session.User.ID, auth.TokenPurposePasswordReset).
+			Count(&count)
+		return count > 1
+	}, 200*time.Millisecond, 20*time.Millisecond)
+
+	w = doJSON(r, "POST", "/api/password/reset", "", map[string]string{"token": token, "password": "newpassword456"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Tokens are single-use and existing sessions are logged out
+	w = doJSON(r, "POST", "/api/password/reset", "", map[string]string{"token": token, "password": "another789"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(r, "GET", "/api/me", session.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = doJSON(r, "POST", "/api/login", "", map[string]string{"email": "forgetful@example.com", "password": "newpassword456"})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestEmailVerification(t *testing.T) {
+	r := setupTestRouter()
+	session := registerUser(t, r, "unverified@example.com")
+	assert.False(t, session.User.EmailVerified)
+
+	// AI endpoints are blocked until the email is confirmed
+	w := doJSON(r, "POST", "/api/ai/generate-report", session.Token, map[string]string{})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Resending right after signup is throttled
+	w = doJSON(r, "POST", "/api/email/verify/resend", session.Token, nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	w = doJSON(r, "POST", "/api/email/verify", "", map[string]string{"token": tokenFromMail(t, "unverified@example.com")})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doJSON(r, "GET", "/api/me", session.Token, nil)
+	var me map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &me)
+	assert.Equal(t, true, me["emailVerified"])
+
+	w = doJSON(r, "POST", "/api/ai/generate-report", session.Token, map[string]string{})
+	assert.NotEqual(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"irontrack-backend/internal/auth"
+	"irontrack-backend/internal/handlers"
+	"irontrack-backend/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImpersonation(t *testing.T) {
+	r := setupTestRouter()
+	admin := registerUser(t, r, "imp-admin@example.com")
+	assert.NoError(t, auth.SetUserRoles(admin.User.ID, []string{models.RoleAdmin}))
+	enableTOTP(t, admin.Token)
+	user := registerUser(t, r, "imp-user@example.com")
+
+	w := doJSON(r, "POST", "/api/plans", user.Token, map[string]interface{}{"id": "imp-plan", "name": "Push day"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// 1. A reason is required and staff can't be impersonated
+	w = doJSON(r, "POST", "/api/admin/users/"+user.User.ID+"/impersonate", admin.Token, map[string]string{})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doJSON(r, "POST", "/api/admin/users/"+admin.User.ID+"/impersonate", admin.Token, map[string]string{"reason": "test"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(r, "POST", "/api/admin/users/"+user.User.ID+"/impersonate", admin.Token, map[string]string{"reason": "Ticket #42"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var started handlers.ImpersonationResponse
+	json.Unmarshal(w.Body.Bytes(), &started)
+
+	claims, err := auth.ValidateToken(started.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, user.User.ID, claims.UserID)
+	assert.Equal(t, admin.User.ID, claims.Actor.Subject)
+
+	// 2. Reads see the user's data
+	w = doJSON(r, "GET", "/api/me", started.Token, nil)
+	var me models.User
+	json.Unmarshal(w.Body.Bytes(), &me)
+	assert.Equal(t, user.User.ID, me.ID)
+	assert.Equal(t, admin.User.ID, me.ImpersonatedBy)
+
+	w = doJSON(r, "GET", "/api/plans", started.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Push day")
+
+	// 3. Writes, account management and admin routes are blocked
+	w = doJSON(r, "POST", "/api/plans", started.Token, map[string]interface{}{"name": "Nope"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "impersonation_read_only")
+	w = doJSON(r, "GET", "/api/sessions", started.Token, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 4. Every request is in the audit log
+	w = doJSON(r, "GET", "/api/admin/impersonations/"+started.Impersonation.ID, admin.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var audit models.Impersonation
+	json.Unmarshal(w.Body.Bytes(), &audit)
+	assert.Equal(t, "Ticket #42", audit.Reason)
+	if assert.Len(t, audit.Requests, 4) {
+		assert.Equal(t, "/api/me", audit.Requests[0].Path)
+		assert.Equal(t, http.StatusForbidden, audit.Requests[2].Status)
+	}
+
+	// 5. Ending the impersonation kills the token
+	w = doJSON(r, "DELETE", "/api/admin/impersonations/"+started.Impersonation.ID, admin.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(r, "GET", "/api/plans", started.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
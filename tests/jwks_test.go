@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"irontrack-backend/internal/auth"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func writePrivateKey(t *testing.T, dir, kid string, key interface{}) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, kid+".pem"), pemBytes, 0o600))
+}
+
+func TestAsymmetricSigningAndKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	writePrivateKey(t, dir, "rsa-2024", rsaKey)
+
+	t.Setenv("JWT_KEYS_DIR", dir)
+	assert.NoError(t, auth.LoadKeys())
+	t.Cleanup(func() {
+		os.Unsetenv("JWT_KEYS_DIR")
+		os.Unsetenv("JWT_ACTIVE_KID")
+		auth.LoadKeys()
+	})
+
+	r := setupTestRouter()
+	session := registerUser(t, r, "rotation@example.com")
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(session.Token, &auth.Claims{})
+	assert.NoError(t, err)
+	assert.Equal(t, "RS256", parsed.Method.Alg())
+	assert.Equal(t, "rsa-2024", parsed.Header["kid"])
+	claims := parsed.Claims.(*auth.Claims)
+	assert.Equal(t, auth.Issuer, claims.Issuer)
+	assert.Equal(t, jwt.ClaimStrings{auth.Audience}, claims.Audience)
+
+	// Rotate to an Ed25519 key; tokens signed with the old key stay valid
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	writePrivateKey(t, dir, "ed-2025", edKey)
+	t.Setenv("JWT_ACTIVE_KID", "ed-2025")
+	assert.NoError(t, auth.LoadKeys())
+
+	w := doJSON(r, "GET", "/api/me", session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doJSON(r, "GET", "/.well-known/jwks.json", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var jwks auth.JWKSet
+	json.Unmarshal(w.Body.Bytes(), &jwks)
+	if assert.Len(t, jwks.Keys, 2) {
+		assert.Equal(t, "OKP", jwks.Keys[0].Kty)
+		assert.Equal(t, "RSA", jwks.Keys[1].Kty)
+	}
+
+	// Retiring the old key invalidates tokens it signed
+	assert.NoError(t, os.Remove(filepath.Join(dir, "rsa-2024.pem")))
+	assert.NoError(t, auth.LoadKeys())
+	w = doJSON(r, "GET", "/api/me", session.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"irontrack-backend/internal/auth"
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/handlers"
+	"irontrack-backend/internal/loginguard"
+	"irontrack-backend/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginLockout(t *testing.T) {
+	r := setupTestRouter()
+	registerUser(t, r, "lockout@example.com")
+
+	now := time.Now()
+	guard := loginguard.New(loginguard.NewDBStore(database.DB))
+	guard.Now = func() time.Time { return now }
+	loginguard.SetDefault(guard)
+	t.Cleanup(func() {
+		guard.Unlock(loginguard.IPKey("192.0.2.1"))
+		loginguard.SetDefault(nil)
+	})
+
+	login := func(password string) (int, string) {
+		w := doJSON(r, "POST", "/api/login", "", map[string]string{"email": "lockout@example.com", "password": password})
+		var body struct {
+			Code string `json:"code"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body.Code
+	}
+
+	// 1. A few mistakes are free
+	for i := 0; i < 3; i++ {
+		code, _ := login("wrong")
+		assert.Equal(t, http.StatusUnauthorized, code)
+	}
+
+	// 2. Then attempts are spaced out, even with the right password
+	code, reason := login("correct-horse-42")
+	assert.Equal(t, http.StatusTooManyRequests, code)
+	assert.Equal(t, "login_throttled", reason)
+
+	// 3. Enough failures lock the account
+	for i := 3; i < guard.Account.LockoutAfter; i++ {
+		now = now.Add(time.Minute)
+		code, _ := login("wrong")
+		assert.Equal(t, http.StatusUnauthorized, code)
+	}
+	now = now.Add(time.Minute)
+	code, reason = login("correct-horse-42")
+	assert.Equal(t, http.StatusTooManyRequests, code)
+	assert.Equal(t, "login_locked", reason)
+
+	// 4. An admin can see and lift the lockout
+	admin := registerUser(t, r, "lockout-admin@example.com")
+	assert.NoError(t, auth.SetUserRoles(admin.User.ID, []string{models.RoleAdmin}))
+	enableTOTP(t, admin.Token)
+
+	w := doJSON(r, "GET", "/api/admin/login-attempts", admin.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "account:lockout@example.com")
+
+	w = doJSON(r, "DELETE", "/api/admin/login-attempts?key=account:lockout@example.com", admin.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	code, _ = login("correct-horse-42")
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestLockoutLongerThanResetWindow(t *testing.T) {
+	now := time.Now()
+	guard := loginguard.New(loginguard.NewMemoryStore())
+	guard.Now = func() time.Time { return now }
+	guard.Account.LockoutDuration = 3 * time.Hour
+
+	for i := 0; i < guard.Account.LockoutAfter; i++ {
+		assert.NoError(t, guard.Fail("long-lock@example.com", "192.0.2.9"))
+	}
+
+	// Well past ResetAfter, the lockout still holds until it runs out
+	now = now.Add(2 * time.Hour)
+	wait, locked, err := guard.Check("long-lock@example.com", "192.0.2.9")
+	assert.NoError(t, err)
+	assert.True(t, locked)
+	assert.Equal(t, time.Hour, wait)
+
+	now = now.Add(time.Hour)
+	_, locked, err = guard.Check("long-lock@example.com", "192.0.2.9")
+	assert.NoError(t, err)
+	assert.False(t, locked)
+}
+
+func TestSecondFactorGuessesCountTowardsLockout(t *testing.T) {
+	r := setupTestRouter()
+	session := registerUser(t, r, "guessed-2fa@example.com")
+	enableTOTP(t, session.Token)
+
+	now := time.Now()
+	guard := loginguard.New(loginguard.NewMemoryStore())
+	guard.Now = func() time.Time { return now }
+	loginguard.SetDefault(guard)
+	t.Cleanup(func() { loginguard.SetDefault(nil) })
+
+	login := func() *httptest.ResponseRecorder {
+		return doJSON(r, "POST", "/api/login", "", map[string]string{"email": "guessed-2fa@example.com", "password": "correct-horse-42"})
+	}
+
+	// Starting over with the right password doesn't reset the count, so wrong
+	// codes end in a lockout like wrong passwords do
+	for i := 0; i < guard.Account.LockoutAfter; i++ {
+		now = now.Add(time.Minute)
+		w := login()
+		if !assert.Equal(t, http.StatusOK, w.Code, "attempt %d", i) {
+			return
+		}
+		var challenge handlers.TwoFactorChallengeResponse
+		json.Unmarshal(w.Body.Bytes(), &challenge)
+		w = doJSON(r, "POST", "/api/login/2fa", "", map[string]string{"challengeToken": challenge.ChallengeToken, "code": "000000"})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	now = now.Add(time.Minute)
+	w := login()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "login_locked")
+}
@@ -0,0 +1,398 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/handlers"
+	"irontrack-backend/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEditAndDeleteLog(t *testing.T) {
+	r := setupTestRouter()
+	owner := registerUser(t, r, "log-editor@example.com")
+	other := registerUser(t, r, "log-snooper@example.com")
+
+	w := doJSON(r, "POST", "/api/logs", owner.Token, map[string]interface{}{
+		"id": "edit-log", "date": "2024-06-01T09:00:00Z", "durationMinutes": 60,
+		"exercises": []map[string]interface{}{
+			{"id": "edit-squat", "name": "Squat", "sets": []map[string]interface{}{
+				{"id": "edit-squat-1", "weight": 1000, "reps": 5, "completed": true},
+				{"id": "edit-squat-2", "weight": 100, "reps": 5, "completed": true},
+			}},
+			{"id": "edit-lunge", "name": "Lunge", "sets": []map[string]interface{}{{"id": "edit-lunge-1", "weight": 20, "reps": 10}}},
+		},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// 1. Fix a typo'd weight, drop a set, remove an exercise and add one
+	w = doJSON(r, "PATCH", "/api/logs/edit-log", owner.Token, map[string]interface{}{
+		"exercises": []map[string]interface{}{
+			{"id": "edit-squat", "name": "Squat", "sets": []map[string]interface{}{
+				{"id": "edit-squat-1", "weight": 100, "reps": 5, "completed": true},
+			}},
+			{"name": "Leg press", "sets": []map[string]interface{}{{"weight": 200, "reps": 12, "completed": true}}},
+		},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var log models.WorkoutLog
+	json.Unmarshal(w.Body.Bytes(), &log)
+	assert.Equal(t, 60, log.DurationMinutes)
+	if assert.Len(t, log.Exercises, 2) {
+		for _, ex := range log.Exercises {
+			if ex.ID == "edit-squat" {
+				if assert.Len(t, ex.Sets, 1) {
+					assert.Equal(t, 100.0, ex.Sets[0].Weight)
+				}
+			} else {
+				assert.Equal(t, "Leg press", ex.Name)
+				assert.NotEmpty(t, ex.ID)
+			}
+		}
+	}
+	var count int64
+	database.DB.Model(&models.LogSet{}).Where("id IN ?", []string{"edit-squat-2", "edit-lunge-1"}).Count(&count)
+	assert.Zero(t, count)
+
+	// 2. Rows of another log can't be claimed
+	doJSON(r, "POST", "/api/logs", other.Token, map[string]interface{}{
+		"id": "other-log", "date": "2024-06-01T09:00:00Z",
+		"exercises": []map[string]interface{}{{"id": "other-bench", "name": "Bench", "sets": []map[string]interface{}{}}},
+	})
+	w = doJSON(r, "PATCH", "/api/logs/edit-log", owner.Token, map[string]interface{}{
+		"exercises": []map[string]interface{}{{"id": "other-bench", "name": "Bench"}},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doJSON(r, "POST", "/api/logs", owner.Token, map[string]interface{}{
+		"id": "claiming-log", "date": "2024-06-02T09:00:00Z",
+		"exercises": []map[string]interface{}{{"id": "other-bench", "name": "Bench"}},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doJSON(r, "POST", "/api/logs", owner.Token, map[string]interface{}{
+		"id": "claiming-log", "date": "2024-06-02T09:00:00Z",
+		"exercises": []map[string]interface{}{{"name": "Squat", "sets": []map[string]interface{}{{"id": "edit-squat-1", "weight": 1, "reps": 1}}}},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var bench models.LogExercise
+	database.DB.First(&bench, "id = ?", "other-bench")
+	assert.Equal(t, "other-log", bench.LogID)
+	var squatSet models.LogSet
+	database.DB.First(&squatSet, "id = ?", "edit-squat-1")
+	assert.Equal(t, 100.0, squatSet.Weight)
+
+	// 3. Only the owner can edit or delete
+	assert.Equal(t, http.StatusNotFound, doJSON(r, "PATCH", "/api/logs/edit-log", other.Token, map[string]int{"durationMinutes": 1}).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(r, "DELETE", "/api/logs/edit-log", other.Token, nil).Code)
+
+	// 4. Delete removes the nested rows too
+	assert.Equal(t, http.StatusOK, doJSON(r, "DELETE", "/api/logs/edit-log", owner.Token, nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(r, "GET", "/api/logs/edit-log", owner.Token, nil).Code)
+	database.DB.Model(&models.LogExercise{}).Where("log_id = ?", "edit-log").Count(&count)
+	assert.Zero(t, count)
+	database.DB.Model(&models.LogSet{}).Where("id = ?", "edit-squat-1").Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestLogHistoryPagination(t *testing.T) {
+	r := setupTestRouter()
+	session := registerUser(t, r, "history@example.com")
+
+	for i, day := range []string{"01", "02", "03", "04", "05"} {
+		plan := "Push"
+		if i%2 == 1 {
+			plan = "Pull"
+		}
+		doJSON(r, "POST", "/api/logs", session.Token, map[string]interface{}{
+			"id": "history-" + day, "date": "2024-03-" + day + "T08:00:00Z", "planName": plan,
+			"exercises": []map[string]interface{}{
+				{"id": "history-ex-" + day, "name": plan + " exercise", "sets": []map[string]interface{}{{"id": "history-set-" + day, "weight": 50, "reps": 8}}},
+			},
+		})
+	}
+
+	ids := func(body []byte) []string {
+		var logs []models.WorkoutLog
+		json.Unmarshal(body, &logs)
+		out := make([]string, len(logs))
+		for i, l := range logs {
+			out[i] = l.ID
+		}
+		return out
+	}
+
+	// 1. Without paging parameters the full history is returned
+	w := doJSON(r, "GET", "/api/logs", session.Token, nil)
+	assert.Len(t, ids(w.Body.Bytes()), 5)
+	assert.Empty(t, w.Header().Get("X-Next-Cursor"))
+
+	// 2. Walk the history two at a time
+	var seen []string
+	cursor := ""
+	for page := 0; page < 5; page++ {
+		url := "/api/logs?limit=2"
+		if cursor != "" {
+			url += "&cursor=" + cursor
+		}
+		w = doJSON(r, "GET", url, session.Token, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		seen = append(seen, ids(w.Body.Bytes())...)
+		cursor = w.Header().Get("X-Next-Cursor")
+		if cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"history-05", "history-04", "history-03", "history-02", "history-01"}, seen)
+
+	// 3. Filters
+	w = doJSON(r, "GET", "/api/logs?from=2024-03-02&to=2024-03-04", session.Token, nil)
+	assert.Equal(t, []string{"history-04", "history-03", "history-02"}, ids(w.Body.Bytes()))
+	w = doJSON(r, "GET", "/api/logs?planName=pull", session.Token, nil)
+	assert.Equal(t, []string{"history-04", "history-02"}, ids(w.Body.Bytes()))
+	w = doJSON(r, "GET", "/api/logs?exercise=PUSH", session.Token, nil)
+	assert.Equal(t, []string{"history-05", "history-03", "history-01"}, ids(w.Body.Bytes()))
+	assert.Equal(t, http.StatusBadRequest, doJSON(r, "GET", "/api/logs?from=yesterday", session.Token, nil).Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(r, "GET", "/api/logs?cursor=garbage", session.Token, nil).Code)
+
+	// 4. Summary mode leaves out the sets
+	w = doJSON(r, "GET", "/api/logs?view=summary&limit=1", session.Token, nil)
+	var logs []models.WorkoutLog
+	json.Unmarshal(w.Body.Bytes(), &logs)
+	if assert.Len(t, logs, 1) && assert.Len(t, logs[0].Exercises, 1) {
+		assert.Empty(t, logs[0].Exercises[0].Sets)
+	}
+}
+
+func TestStartWorkoutFromPlan(t *testing.T) {
+	r := setupTestRouter()
+	session := registerUser(t, r, "draft-starter@example.com")
+	other := registerUser(t, r, "draft-other@example.com")
+
+	doJSON(r, "POST", "/api/plans", session.Token, map[string]interface{}{
+		"id": "draft-plan", "name": "Lower",
+		"exercises": []map[string]interface{}{
+			{"name": "Squat", "defaultSets": 3, "defaultReps": 5},
+			{"name": "Calf raise", "defaultSets": 2, "defaultReps": 15},
+		},
+	})
+	doJSON(r, "POST", "/api/logs", session.Token, map[string]interface{}{
+		"id": "draft-old", "date": "2024-01-01T08:00:00Z",
+		"exercises": []map[string]interface{}{{"id": "draft-old-squat", "name": "squat", "sets": []map[string]interface{}{
+			{"id": "draft-old-1", "weight": 80, "reps": 5, "completed": true},
+		}}},
+	})
+	doJSON(r, "POST", "/api/logs", session.Token, map[string]interface{}{
+		"id": "draft-recent", "date": "2024-02-01T08:00:00Z",
+		"exercises": []map[string]interface{}{{"id": "draft-recent-squat", "name": "Squat", "sets": []map[string]interface{}{
+			{"id": "draft-recent-1", "weight": 100, "reps": 5, "completed": true},
+			{"id": "draft-recent-2", "weight": 110, "reps": 2, "completed": false},
+		}}},
+	})
+
+	// 1. The draft mirrors the plan with weights from the last session
+	w := doJSON(r, "POST", "/api/plans/draft-plan/start", session.Token, nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var draft models.WorkoutLog
+	json.Unmarshal(w.Body.Bytes(), &draft)
+	assert.Equal(t, models.LogStatusDraft, draft.Status)
+	assert.Equal(t, "draft-plan", draft.PlanID)
+	assert.Equal(t, "Lower", draft.PlanName)
+	if assert.Len(t, draft.Exercises, 2) {
+		assert.Equal(t, "Squat", draft.Exercises[0].Name)
+		if assert.Len(t, draft.Exercises[0].Sets, 3) {
+			assert.Equal(t, 100.0, draft.Exercises[0].Sets[0].Weight)
+			assert.Equal(t, 5, draft.Exercises[0].Sets[0].Reps)
+			assert.False(t, draft.Exercises[0].Sets[0].Completed)
+		}
+		if assert.Len(t, draft.Exercises[1].Sets, 2) {
+			assert.Zero(t, draft.Exercises[1].Sets[0].Weight)
+		}
+	}
+
+	// 2. Drafts stay out of the history until completed
+	w = doJSON(r, "GET", "/api/logs", session.Token, nil)
+	var logs []models.WorkoutLog
+	json.Unmarshal(w.Body.Bytes(), &logs)
+	assert.Len(t, logs, 2)
+	w = doJSON(r, "GET", "/api/logs?status=draft", session.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &logs)
+	assert.Len(t, logs, 1)
+
+	w = doJSON(r, "PATCH", "/api/logs/"+draft.ID, session.Token, map[string]string{"status": "draft"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doJSON(r, "PATCH", "/api/logs/"+draft.ID, session.Token, map[string]string{"status": "completed"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(r, "GET", "/api/logs", session.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &logs)
+	assert.Len(t, logs, 3)
+
+	// 3. Only the plan's owner can start it
+	assert.Equal(t, http.StatusNotFound, doJSON(r, "POST", "/api/plans/draft-plan/start", other.Token, nil).Code)
+}
+
+func TestSetDetailsAndTargets(t *testing.T) {
+	r := setupTestRouter()
+	session := registerUser(t, r, "rpe-nerd@example.com")
+
+	set := func(extra map[string]interface{}) map[string]interface{} {
+		s := map[string]interface{}{"weight": 100, "reps": 5, "completed": true}
+		for k, v := range extra {
+			s[k] = v
+		}
+		return s
+	}
+	logWith := func(id string, sets ...map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"id": id, "date": "2024-08-01T08:00:00Z",
+			"exercises": []map[string]interface{}{{"name": "Deadlift", "sets": sets}},
+		}
+	}
+
+	// 1. Out-of-range values are rejected
+	for _, bad := range []map[string]interface{}{
+		{"setType": "cheat"},
+		{"rpe": 10.5},
+		{"rpe": 7.3},
+		{"rir": -1},
+		{"restSeconds": 7200},
+		{"tempo": "slow"},
+	} {
+		w := doJSON(r, "POST", "/api/logs", session.Token, logWith("bad-details", set(bad)))
+		assert.Equal(t, http.StatusBadRequest, w.Code, bad)
+	}
+
+	// 2. Details are stored and the set type defaults to working
+	w := doJSON(r, "POST", "/api/logs", session.Token, logWith("detailed-log",
+		set(map[string]interface{}{"setType": "warmup", "weight": 140}),
+		set(map[string]interface{}{"rpe": 8.5, "rir": 2, "restSeconds": 180, "tempo": "3-1-X-0", "notes": "Belt on"}),
+	))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = doJSON(r, "GET", "/api/logs/detailed-log", session.Token, nil)
+	var log models.WorkoutLog
+	json.Unmarshal(w.Body.Bytes(), &log)
+	if assert.Len(t, log.Exercises, 1) && assert.Len(t, log.Exercises[0].Sets, 2) {
+		warmup, working := log.Exercises[0].Sets[0], log.Exercises[0].Sets[1]
+		assert.Equal(t, models.SetTypeWarmup, warmup.SetType)
+		assert.Equal(t, models.SetTypeWorking, working.SetType)
+		if assert.NotNil(t, working.RPE) {
+			assert.Equal(t, 8.5, *working.RPE)
+		}
+		assert.Equal(t, "3-1-X-0", working.Tempo)
+		assert.Equal(t, "Belt on", working.Notes)
+	}
+
+	// 3. Plan targets carry over into a workout started from the plan;
+	// the heavier warm-up doesn't count as the last working weight
+	w = doJSON(r, "POST", "/api/plans", session.Token, map[string]interface{}{
+		"id": "targets-plan", "name": "Pull",
+		"exercises": []map[string]interface{}{{"name": "Deadlift", "defaultSets": 1, "defaultReps": 3, "warmupSets": 2, "targetRpe": 9, "tempo": "20X0"}},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.StatusBadRequest, doJSON(r, "PATCH", "/api/plans/targets-plan", session.Token, map[string]interface{}{
+		"exercises": []map[string]interface{}{{"name": "Deadlift", "targetRir": 11}},
+	}).Code)
+
+	w = doJSON(r, "POST", "/api/plans/targets-plan/start", session.Token, nil)
+	var draft models.WorkoutLog
+	json.Unmarshal(w.Body.Bytes(), &draft)
+	if assert.Len(t, draft.Exercises, 1) && assert.Len(t, draft.Exercises[0].Sets, 3) {
+		sets := draft.Exercises[0].Sets
+		assert.Equal(t, models.SetTypeWarmup, sets[1].SetType)
+		assert.Equal(t, models.SetTypeWorking, sets[2].SetType)
+		assert.Equal(t, 100.0, sets[2].Weight)
+		if assert.NotNil(t, sets[2].RPE) {
+			assert.Equal(t, 9.0, *sets[2].RPE)
+		}
+		assert.Equal(t, "20X0", sets[2].Tempo)
+	}
+}
+
+func TestTimedAndDistanceExercises(t *testing.T) {
+	r := setupTestRouter()
+	session := registerUser(t, r, "runner@example.com")
+
+	assert.Equal(t, http.StatusBadRequest, doJSON(r, "POST", "/api/exercises", session.Token, map[string]string{
+		"id": "runner-bad", "name": "Swim", "trackingType": "laps",
+	}).Code)
+	w := doJSON(r, "POST", "/api/exercises", session.Token, map[string]string{
+		"id": "runner-run", "name": "Run", "muscleGroup": "Cardio", "trackingType": "distance_duration",
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	logWith := func(id string, exercises ...map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"id": id, "date": "2024-09-0" + id[len(id)-1:] + "T07:00:00Z", "exercises": exercises}
+	}
+
+	// 1. Sets must match the exercise's tracking type
+	for _, bad := range []map[string]interface{}{
+		{"name": "Run", "sets": []map[string]interface{}{{"weight": 20, "distanceMeters": 5000, "durationSeconds": 1500, "completed": true}}},
+		{"name": "Run", "sets": []map[string]interface{}{{"distanceMeters": 5000, "completed": true}}},
+		{"name": "Plank", "trackingType": "duration", "sets": []map[string]interface{}{{"reps": 1, "durationSeconds": 60}}},
+		{"name": "Squat", "sets": []map[string]interface{}{{"weight": 100, "durationSeconds": 30}}},
+	} {
+		assert.Equal(t, http.StatusBadRequest, doJSON(r, "POST", "/api/logs", session.Token, logWith("cardio-bad-1", bad)).Code, bad)
+	}
+
+	w = doJSON(r, "POST", "/api/logs", session.Token, logWith("cardio-1",
+		map[string]interface{}{"name": "run", "sets": []map[string]interface{}{{"distanceMeters": 5000, "durationSeconds": 1500, "completed": true}}},
+		map[string]interface{}{"name": "Plank", "trackingType": "duration", "sets": []map[string]interface{}{{"durationSeconds": 60, "completed": true}}},
+	))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var log models.WorkoutLog
+	json.Unmarshal(w.Body.Bytes(), &log)
+	if assert.Len(t, log.Exercises, 2) {
+		assert.Equal(t, models.TrackingDistanceDuration, log.Exercises[0].TrackingType)
+		assert.Equal(t, models.TrackingDuration, log.Exercises[1].TrackingType)
+	}
+	w = doJSON(r, "POST", "/api/logs", session.Token, logWith("cardio-2",
+		map[string]interface{}{"name": "Run", "sets": []map[string]interface{}{
+			{"distanceMeters": 2000, "durationSeconds": 540, "completed": true},
+			{"distanceMeters": 400, "completed": false},
+		}},
+		map[string]interface{}{"name": "Farmer carry", "trackingType": "weighted_distance", "sets": []map[string]interface{}{{"weight": 32, "distanceMeters": 40, "completed": true}}},
+	))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// 2. Stats total distance and time and work out the pace
+	w = doJSON(r, "GET", "/api/stats/exercises?exercise=run", session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stats []handlers.ExerciseStats
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	if assert.Len(t, stats, 1) {
+		run := stats[0]
+		assert.Equal(t, "Run", run.Name)
+		assert.Equal(t, models.TrackingDistanceDuration, run.TrackingType)
+		assert.Equal(t, time.Date(2024, 9, 2, 7, 0, 0, 0, time.UTC), run.LastPerformed.UTC())
+		assert.Equal(t, 2, run.Workouts)
+		assert.Equal(t, 2, run.Sets)
+		assert.Equal(t, 7000.0, run.DistanceMeters)
+		assert.Equal(t, 2040, run.DurationSeconds)
+		assert.Equal(t, 5000.0, run.LongestDistanceMeters)
+		assert.Equal(t, 270.0, run.BestPace)
+		assert.InDelta(t, 291.43, run.AveragePace, 0.01)
+	}
+	w = doJSON(r, "GET", "/api/stats/exercises", session.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	if assert.Len(t, stats, 3) {
+		assert.Equal(t, "Plank", stats[2].Name)
+		assert.Equal(t, 60, stats[2].LongestDurationSeconds)
+	}
+
+	// 3. A workout started from a plan is pre-filled from the most recent run
+	doJSON(r, "POST", "/api/plans", session.Token, map[string]interface{}{
+		"id": "cardio-plan", "name": "Easy day", "exercises": []map[string]interface{}{{"name": "Run", "defaultSets": 1, "defaultReps": 10}},
+	})
+	w = doJSON(r, "POST", "/api/plans/cardio-plan/start", session.Token, nil)
+	var draft models.WorkoutLog
+	json.Unmarshal(w.Body.Bytes(), &draft)
+	if assert.Len(t, draft.Exercises, 1) && assert.Len(t, draft.Exercises[0].Sets, 1) {
+		set := draft.Exercises[0].Sets[0]
+		assert.Equal(t, 2000.0, set.DistanceMeters)
+		assert.Equal(t, 540, set.DurationSeconds)
+		assert.Zero(t, set.Reps)
+	}
+}
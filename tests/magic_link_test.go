@@ -0,0 +1,39 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"irontrack-backend/internal/handlers"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMagicLinkLogin(t *testing.T) {
+	r := setupTestRouter()
+	registerUser(t, r, "magic@example.com")
+
+	// 1. Unknown emails get the same answer
+	w := doJSON(r, "POST", "/api/login/magic-link", "", map[string]string{"email": "nobody@example.com"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	_, sent := testMailer.LastTo("nobody@example.com")
+	assert.False(t, sent)
+
+	// 2. The link logs the user in
+	w = doJSON(r, "POST", "/api/login/magic-link", "", map[string]string{"email": "magic@example.com"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	token := tokenFromMail(t, "magic@example.com")
+
+	w = doJSON(r, "POST", "/api/login/magic-link/verify", "", map[string]string{"token": token, "deviceName": "Gym tablet"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp handlers.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.NotEmpty(t, resp.Token)
+	assert.NotEmpty(t, resp.RefreshToken)
+	assert.True(t, resp.User.EmailVerified)
+
+	// 3. It only works once
+	w = doJSON(r, "POST", "/api/login/magic-link/verify", "", map[string]string{"token": token})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"irontrack-backend/internal/handlers"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockOIDCProvider is a minimal OpenID Connect provider: discovery, JWKS and a
+// token endpoint that checks PKCE. Tests "authorize" by calling issueCode.
+type mockOIDCProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockAuthorization
+}
+
+type mockAuthorization struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	p := &mockOIDCProvider{key: key, codes: map[string]mockAuthorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "mock-key", "alg": "RS256", "use": "sig",
+			"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		p.mu.Lock()
+		authz, ok := p.codes[r.Form.Get("code")]
+		delete(p.codes, r.Form.Get("code"))
+		p.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != authz.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		claims := jwt.MapClaims{
+			"iss":   p.URL,
+			"aud":   "irontrack-test",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"iat":   time.Now().Unix(),
+			"nonce": authz.nonce,
+		}
+		for k, v := range authz.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "mock-key"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "x", "token_type": "Bearer", "id_token": signed})
+	})
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// issueCode plays the user approving the login at the provider.
+func (p *mockOIDCProvider) issueCode(authorizationURL string, claims jwt.MapClaims) (code, state string) {
+	u, _ := url.Parse(authorizationURL)
+	q := u.Query()
+	code = base64.RawURLEncoding.EncodeToString([]byte(q.Get("state")))
+	p.mu.Lock()
+	p.codes[code] = mockAuthorization{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), claims: claims}
+	p.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider := newMockOIDCProvider(t)
+	t.Setenv("OIDC_PROVIDERS", "mock")
+	t.Setenv("OIDC_MOCK_ISSUER", provider.URL)
+	t.Setenv("OIDC_MOCK_CLIENT_ID", "irontrack-test")
+	t.Setenv("OIDC_MOCK_REDIRECT_URL", "http://localhost:5173/oauth/callback")
+
+	r := setupTestRouter()
+	claims := jwt.MapClaims{"sub": "mock-user-1", "email": "Social@Example.com", "email_verified": true, "name": "Social User"}
+
+	login := func(claims jwt.MapClaims) *httptest.ResponseRecorder {
+		w := doJSON(r, "GET", "/api/oauth/mock/start", "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var start map[string]string
+		json.Unmarshal(w.Body.Bytes(), &start)
+		assert.Contains(t, start["authorizationUrl"], "code_challenge_method=S256")
+
+		code, state := provider.issueCode(start["authorizationUrl"], claims)
+		return doJSON(r, "POST", "/api/oauth/mock/callback", "", map[string]string{"code": code, "state": state})
+	}
+
+	// 1. First login creates a verified account
+	w := login(claims)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var first handlers.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &first)
+	assert.NotEmpty(t, first.Token)
+	assert.Equal(t, "social@example.com", first.User.Email)
+	assert.True(t, first.User.EmailVerified)
+
+	// 2. Logging in again reuses the linked account
+	w = login(claims)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var second handlers.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &second)
+	assert.Equal(t, first.User.ID, second.User.ID)
+
+	// 3. An unverified email can't take over an existing password account
+	registerUser(t, r, "victim@example.com")
+	w = login(jwt.MapClaims{"sub": "attacker", "email": "victim@example.com", "email_verified": false})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// 4. Nor can a verified one while the local account is unconfirmed, since
+	// whoever signed up with the address may not own it
+	pending := registerUser(t, r, "claimed@example.com")
+	verified := jwt.MapClaims{"sub": "owner", "email": "claimed@example.com", "email_verified": true}
+	w = login(verified)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = doJSON(r, "POST", "/api/email/verify", "", map[string]string{"token": tokenFromMail(t, "claimed@example.com")})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = login(verified)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var linked handlers.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &linked)
+	assert.Equal(t, pending.User.ID, linked.User.ID)
+
+	// 5. States are single-use and unknown providers are rejected
+	w = doJSON(r, "POST", "/api/oauth/mock/callback", "", map[string]string{"code": "x", "state": "unknown"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doJSON(r, "GET", "/api/oauth/nope/start", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"irontrack-backend/internal/auth"
+	"irontrack-backend/internal/handlers"
+	"irontrack-backend/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	for _, pw := range []string{"short", "password123", "Summer2024!", "policy@example.com"} {
+		assert.Error(t, auth.ValidatePassword(pw, "policy@example.com"), pw)
+	}
+	assert.NoError(t, auth.ValidatePassword("correct-horse-42", "policy@example.com"))
+
+	r := setupTestRouter()
+	w := doJSON(r, "POST", "/api/register", "", map[string]string{
+		"name": "Weak", "email": "weak@example.com", "password": "qwerty123",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "weak_password")
+}
+
+func TestChangePassword(t *testing.T) {
+	r := setupTestRouter()
+	session := registerUser(t, r, "changer@example.com")
+
+	other := doJSON(r, "POST", "/api/login", "", map[string]string{"email": "changer@example.com", "password": "correct-horse-42"})
+	var otherSession struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(other.Body.Bytes(), &otherSession)
+
+	w := doJSON(r, "POST", "/api/tokens", session.Token, map[string]interface{}{
+		"name": "sync script", "scopes": []string{models.ScopeLogsRead},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var pat handlers.CreateAccessTokenResponse
+	json.Unmarshal(w.Body.Bytes(), &pat)
+
+	// 1. The current password is required
+	w = doJSON(r, "POST", "/api/password/change", session.Token, map[string]string{
+		"currentPassword": "not-my-password", "newPassword": "battery-staple-77",
+	})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// 2. The new password must meet the policy
+	w = doJSON(r, "POST", "/api/password/change", session.Token, map[string]string{
+		"currentPassword": "correct-horse-42", "newPassword": "letmein",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 3. Changing it logs out other devices but keeps this one
+	w = doJSON(r, "POST", "/api/password/change", session.Token, map[string]string{
+		"currentPassword": "correct-horse-42", "newPassword": "battery-staple-77",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(r, "GET", "/api/me", otherSession.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = doJSON(r, "GET", "/api/me", session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	// Access tokens are revoked as well
+	w = doJSON(r, "GET", "/api/logs", pat.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = doJSON(r, "POST", "/api/login", "", map[string]string{"email": "changer@example.com", "password": "battery-staple-77"})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
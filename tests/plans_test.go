@@ -0,0 +1,197 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"irontrack-backend/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdatePlan(t *testing.T) {
+	r := setupTestRouter()
+	owner := registerUser(t, r, "plan-editor@example.com")
+	other := registerUser(t, r, "plan-snooper@example.com")
+
+	w := doJSON(r, "POST", "/api/plans", owner.Token, map[string]interface{}{
+		"id": "editable-plan", "name": "Upper", "description": "v1",
+		"exercises": []map[string]interface{}{
+			{"name": "Bench", "defaultSets": 3, "defaultReps": 8},
+			{"name": "Row", "defaultSets": 3, "defaultReps": 10},
+			{"name": "Curl", "defaultSets": 2, "defaultReps": 12},
+		},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created models.WorkoutPlan
+	json.Unmarshal(w.Body.Bytes(), &created)
+	bench, row, curl := created.Exercises[0], created.Exercises[1], created.Exercises[2]
+
+	// 1. PUT reorders, edits, adds and removes exercises in one go
+	w = doJSON(r, "PUT", "/api/plans/editable-plan", owner.Token, map[string]interface{}{
+		"name": "Upper A",
+		"exercises": []map[string]interface{}{
+			{"id": row.ID, "name": "Row", "defaultSets": 4, "defaultReps": 10},
+			{"id": bench.ID, "name": "Bench", "defaultSets": 3, "defaultReps": 8},
+			{"name": "Face pull", "defaultSets": 3, "defaultReps": 15},
+		},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var updated models.WorkoutPlan
+	json.Unmarshal(w.Body.Bytes(), &updated)
+	assert.Equal(t, "Upper A", updated.Name)
+	assert.Equal(t, "", updated.Description)
+	assert.Equal(t, created.CreatedAt.Unix(), updated.CreatedAt.Unix())
+	if assert.Len(t, updated.Exercises, 3) {
+		assert.Equal(t, row.ID, updated.Exercises[0].ID)
+		assert.Equal(t, 4, updated.Exercises[0].DefaultSets)
+		assert.Equal(t, bench.ID, updated.Exercises[1].ID)
+		assert.Equal(t, "Face pull", updated.Exercises[2].Name)
+		for _, ex := range updated.Exercises {
+			assert.NotEqual(t, curl.ID, ex.ID)
+		}
+	}
+
+	// 2. PATCH only touches the given fields
+	w = doJSON(r, "PATCH", "/api/plans/editable-plan", owner.Token, map[string]string{"description": "v2"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &updated)
+	assert.Equal(t, "Upper A", updated.Name)
+	assert.Equal(t, "v2", updated.Description)
+	assert.Len(t, updated.Exercises, 3)
+
+	// 3. Exercises of another plan can't be pulled in, and nothing changes
+	w = doJSON(r, "PATCH", "/api/plans/editable-plan", owner.Token, map[string]interface{}{
+		"exercises": []map[string]interface{}{{"id": 999999, "name": "Ghost"}},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 4. Other users get a 404
+	w = doJSON(r, "PATCH", "/api/plans/editable-plan", other.Token, map[string]string{"name": "Mine now"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doJSON(r, "GET", "/api/plans", owner.Token, nil)
+	var plans []models.WorkoutPlan
+	json.Unmarshal(w.Body.Bytes(), &plans)
+	if assert.Len(t, plans, 1) {
+		assert.Equal(t, "Upper A", plans[0].Name)
+		assert.Len(t, plans[0].Exercises, 3)
+		assert.Equal(t, row.ID, plans[0].Exercises[0].ID)
+	}
+}
+
+func TestGetPlanAndLogByID(t *testing.T) {
+	r := setupTestRouter()
+	owner := registerUser(t, r, "deep-link@example.com")
+	other := registerUser(t, r, "deep-link-other@example.com")
+
+	doJSON(r, "POST", "/api/plans", owner.Token, map[string]interface{}{
+		"id": "linked-plan", "name": "Full body", "exercises": []map[string]interface{}{{"name": "Deadlift", "defaultSets": 3, "defaultReps": 5}},
+	})
+	doJSON(r, "POST", "/api/logs", owner.Token, map[string]interface{}{
+		"id": "linked-log", "date": "2024-05-01T10:00:00Z", "exercises": []map[string]interface{}{
+			{"id": "linked-log-ex", "name": "Deadlift", "sets": []map[string]interface{}{{"id": "linked-set", "weight": 140, "reps": 5}}},
+		},
+	})
+
+	w := doJSON(r, "GET", "/api/plans/linked-plan", owner.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var plan models.WorkoutPlan
+	json.Unmarshal(w.Body.Bytes(), &plan)
+	assert.Equal(t, "Full body", plan.Name)
+	assert.Len(t, plan.Exercises, 1)
+
+	w = doJSON(r, "GET", "/api/logs/linked-log", owner.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var log models.WorkoutLog
+	json.Unmarshal(w.Body.Bytes(), &log)
+	if assert.Len(t, log.Exercises, 1) {
+		assert.Equal(t, 140.0, log.Exercises[0].Sets[0].Weight)
+	}
+
+	// Unknown IDs and other users' items are both 404
+	assert.Equal(t, http.StatusNotFound, doJSON(r, "GET", "/api/plans/nope", owner.Token, nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(r, "GET", "/api/plans/linked-plan", other.Token, nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(r, "GET", "/api/logs/linked-log", other.Token, nil).Code)
+}
+
+func TestExerciseOrderAndGroups(t *testing.T) {
+	r := setupTestRouter()
+	session := registerUser(t, r, "supersets@example.com")
+
+	superset := func(name string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "defaultSets": 3, "defaultReps": 10, "groupId": "A", "groupType": "superset", "restSeconds": 90}
+	}
+
+	// 1. Groups must be next to each other and agree on type and rest
+	w := doJSON(r, "POST", "/api/plans", session.Token, map[string]interface{}{
+		"id": "split-group", "name": "Arms",
+		"exercises": []map[string]interface{}{superset("Curl"), {"name": "Dip"}, superset("Pushdown")},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	lonely := superset("Curl")
+	w = doJSON(r, "POST", "/api/plans", session.Token, map[string]interface{}{
+		"id": "lonely-group", "name": "Arms", "exercises": []map[string]interface{}{lonely},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 2. Order and grouping survive a round trip
+	w = doJSON(r, "POST", "/api/plans", session.Token, map[string]interface{}{
+		"id": "grouped-plan", "name": "Arms",
+		"exercises": []map[string]interface{}{
+			{"name": "Chin-up", "restSeconds": 120},
+			superset("Curl"),
+			superset("Pushdown"),
+		},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = doJSON(r, "GET", "/api/plans/grouped-plan", session.Token, nil)
+	var plan models.WorkoutPlan
+	json.Unmarshal(w.Body.Bytes(), &plan)
+	if assert.Len(t, plan.Exercises, 3) {
+		assert.Equal(t, []string{"Chin-up", "Curl", "Pushdown"}, []string{plan.Exercises[0].Name, plan.Exercises[1].Name, plan.Exercises[2].Name})
+		assert.Equal(t, 120, plan.Exercises[0].RestSeconds)
+		assert.Equal(t, models.GroupTypeSuperset, plan.Exercises[2].GroupType)
+		assert.Equal(t, "A", plan.Exercises[1].GroupID)
+	}
+
+	// 3. Logs keep order and groups as well
+	w = doJSON(r, "POST", "/api/logs", session.Token, map[string]interface{}{
+		"id": "grouped-log", "date": "2024-07-01T10:00:00Z",
+		"exercises": []map[string]interface{}{
+			{"name": "Row", "groupId": "C", "groupType": "circuit"},
+			{"name": "Swing", "groupId": "C", "groupType": "circuit"},
+			{"name": "Plank"},
+		},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = doJSON(r, "GET", "/api/logs/grouped-log", session.Token, nil)
+	var log models.WorkoutLog
+	json.Unmarshal(w.Body.Bytes(), &log)
+	if assert.Len(t, log.Exercises, 3) {
+		assert.Equal(t, "Row", log.Exercises[0].Name)
+		assert.Equal(t, "Plank", log.Exercises[2].Name)
+		assert.Equal(t, models.GroupTypeCircuit, log.Exercises[1].GroupType)
+	}
+
+	// 4. A live session checks each appended exercise against the ones before
+	assert.Equal(t, http.StatusCreated, doJSON(r, "POST", "/api/workouts", session.Token, nil).Code)
+	add := func(exercise map[string]interface{}) int {
+		return doJSON(r, "POST", "/api/workouts/current/exercises", session.Token, exercise).Code
+	}
+	assert.Equal(t, http.StatusCreated, add(superset("Curl")))
+	assert.Equal(t, http.StatusBadRequest, add(map[string]interface{}{"name": "Dip"}))
+	assert.Equal(t, http.StatusBadRequest, add(map[string]interface{}{"name": "Pushdown", "groupId": "A", "groupType": "circuit", "restSeconds": 90}))
+	assert.Equal(t, http.StatusCreated, add(superset("Pushdown")))
+	assert.Equal(t, http.StatusCreated, add(map[string]interface{}{"name": "Dip", "restSeconds": 60}))
+	assert.Equal(t, http.StatusBadRequest, add(superset("Hammer curl")))
+	w = doJSON(r, "GET", "/api/workouts/current", session.Token, nil)
+	var live models.WorkoutLog
+	json.Unmarshal(w.Body.Bytes(), &live)
+	if assert.Len(t, live.Exercises, 3) {
+		assert.Equal(t, "A", live.Exercises[1].GroupID)
+		assert.Equal(t, 90, live.Exercises[1].RestSeconds)
+		assert.Equal(t, 60, live.Exercises[2].RestSeconds)
+	}
+}
@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/handlers"
+	"irontrack-backend/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrainingPrograms(t *testing.T) {
+	r := setupTestRouter()
+	owner := registerUser(t, r, "program-owner@example.com")
+	other := registerUser(t, r, "program-other@example.com")
+
+	for _, id := range []string{"program-upper", "program-lower"} {
+		doJSON(r, "POST", "/api/plans", owner.Token, map[string]interface{}{
+			"id": id, "name": id, "exercises": []map[string]interface{}{{"name": "Main lift", "defaultSets": 4, "defaultReps": 5}},
+		})
+	}
+	doJSON(r, "POST", "/api/plans", other.Token, map[string]interface{}{"id": "program-foreign", "name": "Not yours"})
+
+	days := []map[string]interface{}{
+		{"name": "Upper", "planId": "program-upper"},
+		{"name": "Lower", "planId": "program-lower"},
+	}
+	program := map[string]interface{}{
+		"name": "Block", "weightIncrement": 2.5, "repIncrement": 1, "deloadPercent": 50,
+		"weeks": []map[string]interface{}{{"days": days}, {"days": days}, {"deload": true, "days": days}},
+	}
+
+	// 1. Days must use the caller's own plans
+	w := doJSON(r, "POST", "/api/programs", owner.Token, map[string]interface{}{
+		"name": "Sneaky", "weeks": []map[string]interface{}{{"days": []map[string]interface{}{{"name": "A", "planId": "program-foreign"}}}},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = doJSON(r, "POST", "/api/programs", owner.Token, map[string]interface{}{"name": "Empty", "weeks": []map[string]interface{}{}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON(r, "POST", "/api/programs", owner.Token, program)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created models.Program
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if assert.Len(t, created.Weeks, 3) {
+		assert.Equal(t, 3, created.Weeks[2].Number)
+		assert.True(t, created.Weeks[2].Deload)
+		assert.Len(t, created.Weeks[0].Days, 2)
+	}
+	assert.Equal(t, http.StatusNotFound, doJSON(r, "GET", "/api/programs/"+created.ID, other.Token, nil).Code)
+
+	// 2. Follow the program and walk through it
+	assert.Equal(t, http.StatusNotFound, doJSON(r, "GET", "/api/programs/current", owner.Token, nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(r, "PUT", "/api/programs/current", other.Token, map[string]string{"programId": created.ID}).Code)
+	w = doJSON(r, "PUT", "/api/programs/current", owner.Token, map[string]string{"programId": created.ID})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var day handlers.ProgramDayResponse
+	json.Unmarshal(w.Body.Bytes(), &day)
+	assert.Equal(t, "Upper", day.Day.Name)
+	if assert.Len(t, day.Exercises, 1) {
+		assert.Equal(t, 5, day.Exercises[0].TargetReps)
+		assert.Zero(t, day.Exercises[0].WeightIncrease)
+	}
+
+	for i := 0; i < 3; i++ {
+		w = doJSON(r, "POST", "/api/programs/current/advance", owner.Token, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	json.Unmarshal(w.Body.Bytes(), &day)
+	assert.Equal(t, 2, day.Week.Number)
+	assert.Equal(t, "Lower", day.Day.Name)
+	if assert.Len(t, day.Exercises, 1) {
+		assert.Equal(t, 6, day.Exercises[0].TargetReps)
+		assert.Equal(t, 2.5, day.Exercises[0].WeightIncrease)
+		assert.Equal(t, 4, day.Exercises[0].TargetSets)
+	}
+
+	// 3. Deload week halves sets and weights but keeps the progression
+	w = doJSON(r, "POST", "/api/programs/current/advance", owner.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &day)
+	assert.True(t, day.Week.Deload)
+	if assert.Len(t, day.Exercises, 1) {
+		assert.Equal(t, 2, day.Exercises[0].TargetSets)
+		assert.Equal(t, 7, day.Exercises[0].TargetReps)
+		assert.Equal(t, 5.0, day.Exercises[0].WeightIncrease)
+		assert.Equal(t, 0.5, day.Exercises[0].WeightFactor)
+	}
+
+	// 4. Past the last day the program is completed
+	doJSON(r, "POST", "/api/programs/current/advance", owner.Token, nil)
+	w = doJSON(r, "POST", "/api/programs/current/advance", owner.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &day)
+	assert.True(t, day.Completed)
+	assert.NotNil(t, day.Progress.CompletedAt)
+	assert.Equal(t, http.StatusBadRequest, doJSON(r, "POST", "/api/programs/current/advance", owner.Token, nil).Code)
+
+	// 5. Shrinking the program moves a stranded pointer back to the start
+	doJSON(r, "PUT", "/api/programs/current", owner.Token, map[string]interface{}{"programId": created.ID, "week": 3, "day": 1})
+	program["weeks"] = []map[string]interface{}{{"days": days[:1]}}
+	w = doJSON(r, "PUT", "/api/programs/"+created.ID, owner.Token, program)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(r, "GET", "/api/programs/current", owner.Token, nil)
+	json.Unmarshal(w.Body.Bytes(), &day)
+	assert.Equal(t, 1, day.Progress.Week)
+	assert.Equal(t, 0, day.Progress.Day)
+
+	// 6. Deleting the program removes its weeks, days and the pointer
+	assert.Equal(t, http.StatusNotFound, doJSON(r, "DELETE", "/api/programs/"+created.ID, other.Token, nil).Code)
+	assert.Equal(t, http.StatusOK, doJSON(r, "DELETE", "/api/programs/"+created.ID, owner.Token, nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(r, "GET", "/api/programs/current", owner.Token, nil).Code)
+	var count int64
+	database.DB.Model(&models.ProgramWeek{}).Where("program_id = ?", created.ID).Count(&count)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"irontrack-backend/internal/auth"
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/handlers"
+	"irontrack-backend/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRolePermissions(t *testing.T) {
+	r := setupTestRouter()
+	admin := registerUser(t, r, "roles-admin@example.com")
+	assert.NoError(t, auth.SetUserRoles(admin.User.ID, []string{models.RoleAdmin}))
+	enableTOTP(t, admin.Token)
+
+	support := registerUser(t, r, "roles-support@example.com")
+	enableTOTP(t, support.Token)
+
+	// 1. Without a role there is no admin access at all
+	w := doJSON(r, "GET", "/api/admin/users", support.Token, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 2. Admins assign roles
+	w = doJSON(r, "PUT", "/api/admin/users/"+support.User.ID+"/roles", admin.Token, map[string][]string{"roles": {models.RoleSupport}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(r, "PUT", "/api/admin/users/"+support.User.ID+"/roles", admin.Token, map[string][]string{"roles": {"nope"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 3. Support can read users but not delete them or grant roles
+	w = doJSON(r, "GET", "/api/admin/users", support.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(r, "DELETE", "/api/admin/users/"+admin.User.ID, support.Token, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doJSON(r, "PUT", "/api/admin/users/"+support.User.ID+"/roles", support.Token, map[string][]string{"roles": {models.RoleAdmin}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 4. /me reports the effective permissions
+	w = doJSON(r, "GET", "/api/me", support.Token, nil)
+	var me models.User
+	json.Unmarshal(w.Body.Bytes(), &me)
+	assert.Contains(t, me.Permissions, models.PermUsersRead)
+	assert.NotContains(t, me.Permissions, models.PermUsersDelete)
+
+	// 5. Custom roles can be created, built-in ones are locked
+	w = doJSON(r, "POST", "/api/admin/roles", admin.Token, map[string]interface{}{
+		"name": "auditor", "permissions": []string{models.PermAIRequestsRead},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	w = doJSON(r, "DELETE", "/api/admin/roles/"+models.RoleAdmin, admin.Token, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAdminEmailChangeNeedsVerification(t *testing.T) {
+	r := setupTestRouter()
+	admin := registerUser(t, r, "email-admin@example.com")
+	assert.NoError(t, auth.SetUserRoles(admin.User.ID, []string{models.RoleAdmin}))
+	enableTOTP(t, admin.Token)
+
+	user := registerUser(t, r, "old-address@example.com")
+	w := doJSON(r, "POST", "/api/email/verify", "", map[string]string{"token": tokenFromMail(t, "old-address@example.com")})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Renaming leaves the confirmed address alone
+	w = doJSON(r, "PUT", "/api/admin/users/"+user.User.ID, admin.Token, map[string]string{"name": "Renamed", "email": "old-address@example.com"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var updated models.User
+	json.Unmarshal(w.Body.Bytes(), &updated)
+	assert.True(t, updated.EmailVerified)
+
+	w = doJSON(r, "PUT", "/api/admin/users/"+user.User.ID, admin.Token, map[string]string{"email": "new-address@example.com"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var moved models.User
+	json.Unmarshal(w.Body.Bytes(), &moved)
+	assert.False(t, moved.EmailVerified)
+	assert.Nil(t, moved.EmailVerifiedAt)
+
+	w = doJSON(r, "POST", "/api/email/verify", "", map[string]string{"token": tokenFromMail(t, "new-address@example.com")})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAdminDeleteUserEndsAccess(t *testing.T) {
+	r := setupTestRouter()
+	admin := registerUser(t, r, "delete-admin@example.com")
+	assert.NoError(t, auth.SetUserRoles(admin.User.ID, []string{models.RoleAdmin}))
+	enableTOTP(t, admin.Token)
+
+	user := registerUser(t, r, "deleted-by-admin@example.com")
+	w := doJSON(r, "POST", "/api/tokens", user.Token, map[string]interface{}{
+		"name": "script", "scopes": []string{models.ScopeLogsRead},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var pat handlers.CreateAccessTokenResponse
+	json.Unmarshal(w.Body.Bytes(), &pat)
+
+	w = doJSON(r, "DELETE", "/api/admin/users/"+user.User.ID, admin.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The account is only soft-deleted, but nothing it had still works
+	var count int64
+	database.DB.Unscoped().Model(&models.User{}).Where("id = ?", user.User.ID).Count(&count)
+	assert.Equal(t, int64(1), count)
+	assert.Equal(t, http.StatusUnauthorized, doJSON(r, "GET", "/api/me", user.Token, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, doJSON(r, "GET", "/api/logs", pat.Token, nil).Code)
+}
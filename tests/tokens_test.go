@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"irontrack-backend/internal/handlers"
+	"irontrack-backend/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPersonalAccessTokens(t *testing.T) {
+	r := setupTestRouter()
+	session := registerUser(t, r, "pat@example.com")
+
+	// 1. Create a read-only token for logs
+	w := doJSON(r, "POST", "/api/tokens", session.Token, map[string]interface{}{
+		"name": "export script", "scopes": []string{models.ScopeLogsRead},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created handlers.CreateAccessTokenResponse
+	json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Contains(t, created.Token, "itk_")
+	assert.Equal(t, []string{models.ScopeLogsRead}, created.Scopes)
+
+	w = doJSON(r, "POST", "/api/tokens", session.Token, map[string]interface{}{
+		"name": "bad", "scopes": []string{"everything"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 2. The token works for its scope only
+	w = doJSON(r, "GET", "/api/logs", created.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(r, "POST", "/api/plans", created.Token, map[string]interface{}{"name": "Nope"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 3. It can't manage the account
+	w = doJSON(r, "POST", "/api/tokens", created.Token, map[string]interface{}{
+		"name": "escalate", "scopes": []string{models.ScopePlansWrite},
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doJSON(r, "GET", "/api/sessions", created.Token, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 4. Listing never exposes the secret
+	w = doJSON(r, "GET", "/api/tokens", session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Token)
+	assert.Contains(t, w.Body.String(), created.Prefix)
+
+	// 5. Revoked tokens stop working
+	w = doJSON(r, "DELETE", "/api/tokens/"+created.ID, session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(r, "GET", "/api/logs", created.Token, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
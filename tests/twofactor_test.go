@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"irontrack-backend/internal/auth"
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/handlers"
+	"irontrack-backend/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// enableTOTP enrolls the user behind token and returns the secret and recovery codes.
+func enableTOTP(t *testing.T, token string) (string, []string) {
+	r := setupTestRouter()
+
+	w := doJSON(r, "POST", "/api/2fa/totp/setup", token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var setup map[string]string
+	json.Unmarshal(w.Body.Bytes(), &setup)
+	assert.Contains(t, setup["otpauthUri"], "otpauth://totp/IronTrack:")
+
+	code, _ := auth.TOTPCode(setup["secret"], auth.TOTPCounter(time.Now()))
+	w = doJSON(r, "POST", "/api/2fa/totp/enable", token, map[string]string{"code": code})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var enabled struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &enabled)
+	assert.Len(t, enabled.RecoveryCodes, 10)
+
+	return setup["secret"], enabled.RecoveryCodes
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	r := setupTestRouter()
+	session := registerUser(t, r, "totp@example.com")
+	secret, recoveryCodes := enableTOTP(t, session.Token)
+
+	login := func() string {
+		w := doJSON(r, "POST", "/api/login", "", map[string]string{"email": "totp@example.com", "password": "correct-horse-42"})
+		assert.Equal(t, http.StatusOK, w.Code)
+		var challenge handlers.TwoFactorChallengeResponse
+		json.Unmarshal(w.Body.Bytes(), &challenge)
+		assert.True(t, challenge.TwoFactorRequired)
+		return challenge.ChallengeToken
+	}
+
+	// 1. The code used for enrollment can't be replayed
+	challenge := login()
+	used, _ := auth.TOTPCode(secret, auth.TOTPCounter(time.Now()))
+	w := doJSON(r, "POST", "/api/login/2fa", "", map[string]string{"challengeToken": challenge, "code": used})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// 2. The next code completes the login
+	next, _ := auth.TOTPCode(secret, auth.TOTPCounter(time.Now())+1)
+	w = doJSON(r, "POST", "/api/login/2fa", "", map[string]string{"challengeToken": challenge, "code": next})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp handlers.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.NotEmpty(t, resp.Token)
+
+	// 3. Recovery codes work once
+	w = doJSON(r, "POST", "/api/login/2fa", "", map[string]string{"challengeToken": login(), "recoveryCode": recoveryCodes[0]})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(r, "POST", "/api/login/2fa", "", map[string]string{"challengeToken": login(), "recoveryCode": recoveryCodes[0]})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAdminRequiresTwoFactor(t *testing.T) {
+	r := setupTestRouter()
+	session := registerUser(t, r, "admin-2fa@example.com")
+	assert.NoError(t, auth.SetUserRoles(session.User.ID, []string{models.RoleAdmin}))
+
+	w := doJSON(r, "GET", "/api/admin/summary", session.Token, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Deleting a global exercise outside the admin routes needs it too
+	w = doJSON(r, "POST", "/api/email/verify", "", map[string]string{"token": tokenFromMail(t, "admin-2fa@example.com")})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, database.DB.Create(&models.ExerciseDefinition{ID: "global-2fa-squat", IsGlobal: true, Name: "Squat"}).Error)
+	w = doJSON(r, "DELETE", "/api/exercises/global-2fa-squat", session.Token, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Enrolling from this session counts as passing the second factor here
+	enableTOTP(t, session.Token)
+	w = doJSON(r, "GET", "/api/admin/summary", session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doJSON(r, "DELETE", "/api/exercises/global-2fa-squat", session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,246 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"testing"
+
+	"irontrack-backend/internal/auth"
+	"irontrack-backend/internal/handlers"
+	"irontrack-backend/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// softAuthenticator is a software WebAuthn authenticator holding one ES256 passkey.
+type softAuthenticator struct {
+	key       *ecdsa.PrivateKey
+	credID    []byte
+	userID    []byte
+	signCount uint32
+	origin    string
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	credID := make([]byte, 16)
+	rand.Read(credID)
+	return &softAuthenticator{key: key, credID: credID, origin: auth.WebAuthnOrigins[0]}
+}
+
+func (a *softAuthenticator) clientData(typ, challenge string) []byte {
+	data, _ := json.Marshal(map[string]string{"type": typ, "challenge": challenge, "origin": a.origin})
+	return data
+}
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(auth.WebAuthnRPID))
+	a.signCount++
+	var buf bytes.Buffer
+	buf.Write(rpIDHash[:])
+	buf.WriteByte(flags)
+	binary.Write(&buf, binary.BigEndian, a.signCount)
+	buf.Write(attested)
+	return buf.Bytes()
+}
+
+// create answers navigator.credentials.create() options.
+func (a *softAuthenticator) create(options auth.WebAuthnCreationOptions) map[string]interface{} {
+	a.userID, _ = auth.DecodeWebAuthnBase64(options.User.ID)
+
+	coseKey := cborEncode(map[interface{}]interface{}{
+		int64(1): int64(2), int64(3): int64(-7), int64(-1): int64(1),
+		int64(-2): a.key.X.FillBytes(make([]byte, 32)),
+		int64(-3): a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	var attested bytes.Buffer
+	attested.Write(make([]byte, 16)) // AAGUID
+	binary.Write(&attested, binary.BigEndian, uint16(len(a.credID)))
+	attested.Write(a.credID)
+	attested.Write(coseKey)
+
+	attestationObject := cborEncode(map[interface{}]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[interface{}]interface{}{},
+		"authData": a.authData(0x45, attested.Bytes()), // UP | UV | AT
+	})
+	return map[string]interface{}{
+		"id":   b64(a.credID),
+		"type": "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64(a.clientData("webauthn.create", options.Challenge)),
+			"attestationObject": b64(attestationObject),
+		},
+	}
+}
+
+// get answers navigator.credentials.get() options.
+func (a *softAuthenticator) get(options auth.WebAuthnRequestOptions) map[string]interface{} {
+	clientData := a.clientData("webauthn.get", options.Challenge)
+	authData := a.authData(0x05, nil) // UP | UV
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	sig, _ := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	return map[string]interface{}{
+		"id":   b64(a.credID),
+		"type": "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64(clientData),
+			"authenticatorData": b64(authData),
+			"signature":         b64(sig),
+			"userHandle":        b64(a.userID),
+		},
+	}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// cborEncode writes the handful of CBOR types the authenticator needs.
+func cborEncode(v interface{}) []byte {
+	var buf bytes.Buffer
+	head := func(major byte, n uint64) {
+		switch {
+		case n < 24:
+			buf.WriteByte(major<<5 | byte(n))
+		case n < 256:
+			buf.WriteByte(major<<5 | 24)
+			buf.WriteByte(byte(n))
+		default:
+			buf.WriteByte(major<<5 | 25)
+			binary.Write(&buf, binary.BigEndian, uint16(n))
+		}
+	}
+	var enc func(v interface{})
+	enc = func(v interface{}) {
+		switch x := v.(type) {
+		case int64:
+			if x >= 0 {
+				head(0, uint64(x))
+			} else {
+				head(1, uint64(-1-x))
+			}
+		case string:
+			head(3, uint64(len(x)))
+			buf.WriteString(x)
+		case []byte:
+			head(2, uint64(len(x)))
+			buf.Write(x)
+		case map[interface{}]interface{}:
+			head(5, uint64(len(x)))
+			keys := make([]interface{}, 0, len(x))
+			for k := range x {
+				keys = append(keys, k)
+			}
+			sort.Slice(keys, func(i, j int) bool { return string(cborEncode(keys[i])) < string(cborEncode(keys[j])) })
+			for _, k := range keys {
+				enc(k)
+				enc(x[k])
+			}
+		}
+	}
+	enc(v)
+	return buf.Bytes()
+}
+
+func TestWebAuthnPasskeys(t *testing.T) {
+	r := setupTestRouter()
+	session := registerUser(t, r, "passkey@example.com")
+	authenticator := newSoftAuthenticator(t)
+	// A session from before the passkey existed, which never passed it
+	w := doJSON(r, "POST", "/api/login", "", map[string]string{"email": "passkey@example.com", "password": "correct-horse-42"})
+	var older handlers.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &older)
+
+	// 1. Register a passkey
+	w = doJSON(r, "POST", "/api/webauthn/register/begin", session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var begin struct {
+		CeremonyID string                       `json:"ceremonyId"`
+		PublicKey  auth.WebAuthnCreationOptions `json:"publicKey"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &begin)
+
+	w = doJSON(r, "POST", "/api/webauthn/register/finish", session.Token, map[string]interface{}{
+		"ceremonyId": begin.CeremonyID, "name": "Phone", "credential": authenticator.create(begin.PublicKey),
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var registered struct {
+		Credential    models.WebAuthnCredential `json:"credential"`
+		RecoveryCodes []string                  `json:"recoveryCodes"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &registered)
+	assert.Equal(t, "Phone", registered.Credential.Name)
+	assert.Len(t, registered.RecoveryCodes, 10)
+
+	// 2. Passwordless login with the passkey
+	loginWithPasskey := func() *http.Response {
+		w := doJSON(r, "POST", "/api/login/passkey/begin", "", nil)
+		var begin struct {
+			CeremonyID string                      `json:"ceremonyId"`
+			PublicKey  auth.WebAuthnRequestOptions `json:"publicKey"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &begin)
+		w = doJSON(r, "POST", "/api/login/passkey/finish", "", map[string]interface{}{
+			"ceremonyId": begin.CeremonyID, "credential": authenticator.get(begin.PublicKey),
+		})
+		return w.Result()
+	}
+	resp := loginWithPasskey()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var authResp handlers.AuthResponse
+	json.NewDecoder(resp.Body).Decode(&authResp)
+	assert.Equal(t, session.User.ID, authResp.User.ID)
+
+	// 3. A cloned authenticator replaying an old counter is rejected
+	authenticator.signCount = 0
+	assert.Equal(t, http.StatusUnauthorized, loginWithPasskey().StatusCode)
+	authenticator.signCount = 100
+
+	// 4. Password logins now need the passkey as a second factor
+	w = doJSON(r, "POST", "/api/login", "", map[string]string{"email": "passkey@example.com", "password": "correct-horse-42"})
+	var challenge handlers.TwoFactorChallengeResponse
+	json.Unmarshal(w.Body.Bytes(), &challenge)
+	assert.True(t, challenge.TwoFactorRequired)
+	assert.Contains(t, challenge.Methods, "webauthn")
+
+	w = doJSON(r, "POST", "/api/login/2fa/webauthn", "", map[string]string{"challengeToken": challenge.ChallengeToken})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var second struct {
+		CeremonyID string                      `json:"ceremonyId"`
+		PublicKey  auth.WebAuthnRequestOptions `json:"publicKey"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &second)
+	assert.Len(t, second.PublicKey.AllowCredentials, 1)
+
+	w = doJSON(r, "POST", "/api/login/2fa", "", map[string]interface{}{
+		"challengeToken": challenge.ChallengeToken,
+		"webauthn":       map[string]interface{}{"ceremonyId": second.CeremonyID, "credential": authenticator.get(second.PublicKey)},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 5. A passkey counts as the second factor admins need
+	assert.NoError(t, auth.SetUserRoles(session.User.ID, []string{models.RoleAdmin}))
+	var admin handlers.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &admin)
+	w = doJSON(r, "GET", "/api/admin/summary", admin.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 6. Adding TOTP needs a session that passed the passkey
+	w = doJSON(r, "POST", "/api/2fa/totp/setup", older.Token, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doJSON(r, "POST", "/api/2fa/totp/enable", older.Token, map[string]string{"code": "123456"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doJSON(r, "POST", "/api/2fa/totp/setup", admin.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"irontrack-backend/internal/database"
+	"irontrack-backend/internal/handlers"
+	"irontrack-backend/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLiveWorkoutSession(t *testing.T) {
+	r := setupTestRouter()
+	session := registerUser(t, r, "live-lifter@example.com")
+	// A second login stands in for another device
+	w := doJSON(r, "POST", "/api/login", "", map[string]string{"email": "live-lifter@example.com", "password": "correct-horse-42"})
+	var phone handlers.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &phone)
+
+	doJSON(r, "POST", "/api/plans", session.Token, map[string]interface{}{
+		"id": "live-plan", "name": "Push", "exercises": []map[string]interface{}{{"name": "Bench", "defaultSets": 2, "defaultReps": 8}},
+	})
+
+	assert.Equal(t, http.StatusNotFound, doJSON(r, "GET", "/api/workouts/current", session.Token, nil).Code)
+
+	// 1. Start from a plan; a second start hands back the open session
+	w = doJSON(r, "POST", "/api/workouts", session.Token, map[string]string{"planId": "live-plan"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var live models.WorkoutLog
+	json.Unmarshal(w.Body.Bytes(), &live)
+	assert.Equal(t, models.LogStatusInProgress, live.Status)
+	assert.NotNil(t, live.StartedAt)
+	if !assert.Len(t, live.Exercises, 1) {
+		return
+	}
+	bench := live.Exercises[0]
+	assert.Equal(t, http.StatusConflict, doJSON(r, "POST", "/api/workouts", phone.Token, nil).Code)
+	// The database holds the line too, for starts that race past that check
+	now := time.Now()
+	assert.Error(t, database.DB.Create(&models.WorkoutLog{
+		ID: "live-racing-start", UserID: session.User.ID, Date: now, Status: models.LogStatusInProgress, StartedAt: &now,
+	}).Error)
+
+	// 2. Sets are saved one at a time and a retried append isn't duplicated
+	w = doJSON(r, "PATCH", "/api/workouts/current/sets/"+bench.Sets[0].ID, session.Token, map[string]interface{}{"weight": 60, "completed": true})
+	assert.Equal(t, http.StatusOK, w.Code)
+	extra := map[string]interface{}{"id": "live-extra-set", "weight": 50, "reps": 12, "completed": true}
+	assert.Equal(t, http.StatusCreated, doJSON(r, "POST", "/api/workouts/current/exercises/"+bench.ID+"/sets", session.Token, extra).Code)
+	assert.Equal(t, http.StatusOK, doJSON(r, "POST", "/api/workouts/current/exercises/"+bench.ID+"/sets", session.Token, extra).Code)
+	w = doJSON(r, "POST", "/api/workouts/current/exercises", session.Token, map[string]string{"name": "Dips"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.StatusOK, doJSON(r, "DELETE", "/api/workouts/current/sets/"+bench.Sets[1].ID, session.Token, nil).Code)
+	assert.Equal(t, http.StatusNotFound, doJSON(r, "PATCH", "/api/workouts/current/sets/nope", session.Token, map[string]int{"reps": 1}).Code)
+
+	// 3. The other device picks the session up where it was left
+	w = doJSON(r, "GET", "/api/workouts/current", phone.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &live)
+	if assert.Len(t, live.Exercises, 2) && assert.Len(t, live.Exercises[0].Sets, 2) {
+		assert.Equal(t, 60.0, live.Exercises[0].Sets[0].Weight)
+		assert.Equal(t, "live-extra-set", live.Exercises[0].Sets[1].ID)
+		assert.Equal(t, "Dips", live.Exercises[1].Name)
+	}
+
+	// 4. Pausing is tracked and the server works out the duration
+	assert.Equal(t, http.StatusOK, doJSON(r, "POST", "/api/workouts/current/pause", session.Token, nil).Code)
+	assert.Equal(t, http.StatusConflict, doJSON(r, "POST", "/api/workouts/current/pause", session.Token, nil).Code)
+	assert.Equal(t, http.StatusOK, doJSON(r, "POST", "/api/workouts/current/resume", session.Token, nil).Code)
+	database.DB.Model(&models.WorkoutLog{}).Where("id = ?", live.ID).Updates(map[string]interface{}{
+		"started_at":     time.Now().Add(-45 * time.Minute),
+		"paused_seconds": 300,
+	})
+	w = doJSON(r, "POST", "/api/workouts/current/finish", session.Token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &live)
+	assert.Equal(t, models.LogStatusCompleted, live.Status)
+	assert.Equal(t, 40, live.DurationMinutes)
+	assert.NotNil(t, live.FinishedAt)
+	assert.Equal(t, http.StatusNotFound, doJSON(r, "GET", "/api/workouts/current", session.Token, nil).Code)
+
+	// 5. A discarded session leaves nothing behind
+	w = doJSON(r, "POST", "/api/workouts", session.Token, map[string]string{"planName": "Quick one"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var discarded models.WorkoutLog
+	json.Unmarshal(w.Body.Bytes(), &discarded)
+	assert.Equal(t, http.StatusOK, doJSON(r, "DELETE", "/api/workouts/current", session.Token, nil).Code)
+	var count int64
+	database.DB.Model(&models.WorkoutLog{}).Where("id = ?", discarded.ID).Count(&count)
+	assert.Zero(t, count)
+
+	w = doJSON(r, "GET", "/api/logs", session.Token, nil)
+	var logs []models.WorkoutLog
+	json.Unmarshal(w.Body.Bytes(), &logs)
+	assert.Len(t, logs, 1)
+}